@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// bandAlignment keeps bands on JPEG MCU boundaries, so the encoder never
+// steps back into a band that was already discarded.
+const bandAlignment = 16
+
+// bandedImage maps its source lazily one band of rows at a time, as encoders
+// read top to bottom. It must not be read concurrently.
+type bandedImage struct {
+	mapper     *ImageMapper
+	pool       *workerPool
+	bandHeight int
+	band       *image.RGBA
+}
+
+func newBandedImage(mapper *ImageMapper, pool *workerPool, bandHeight int) *bandedImage {
+	return &bandedImage{
+		mapper:     mapper,
+		pool:       pool,
+		bandHeight: bandHeight,
+		band:       &image.RGBA{},
+	}
+}
+
+func (b *bandedImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (b *bandedImage) Bounds() image.Rectangle {
+	return b.mapper.LoadedImage.Bounds()
+}
+
+// Opaque answers from the source, so the PNG encoder does not map every band
+// up front to find out.
+func (b *bandedImage) Opaque() bool {
+	return true
+}
+
+func (b *bandedImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(b.Bounds())) {
+		return color.RGBA{}
+	}
+
+	if !(image.Point{x, y}.In(b.band.Rect)) {
+		b.mapBandAt(y)
+	}
+
+	return b.band.RGBAAt(x, y)
+}
+
+func (b *bandedImage) mapBandAt(y int) {
+	bounds := b.Bounds()
+	top := bounds.Min.Y + (y-bounds.Min.Y)/b.bandHeight*b.bandHeight
+	rect := image.Rect(bounds.Min.X, top, bounds.Max.X, top+b.bandHeight).Intersect(bounds)
+
+	if b.band.Rect.Dx() == rect.Dx() && b.band.Rect.Dy() == rect.Dy() {
+		// Reuse the previous band's pixels instead of allocating a new buffer.
+		b.band.Rect = rect
+	} else {
+		b.band = image.NewRGBA(rect)
+	}
+
+	b.mapper.QuantizeRectToPalette(b.pool, b.band, rect)
+}
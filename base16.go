@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	// accentMinimumChroma is the OKLCh chroma a candidate needs to be taken
+	// as an accent.
+	accentMinimumChroma = 0.04
+	// accentHueTolerance is how far in degrees a candidate may lie from the
+	// hue of an accent slot.
+	accentHueTolerance = 40
+	// accentMinimumContrast is the WCAG contrast accents get against base00.
+	accentMinimumContrast = 3
+	// accentMinimumRampDistance is how far in OKLab a candidate must be from
+	// every color of the ramp to be taken as an accent.
+	accentMinimumRampDistance = 0.05
+	// backgroundMinimumCoverage keeps specks from becoming the background.
+	backgroundMinimumCoverage = 0.01
+)
+
+// base16Accent is an accent slot, base08 to base0F, with its canonical OKLCh
+// hue.
+type base16Accent struct {
+	Key  string
+	Name string
+	Hue  float64
+}
+
+var base16Accents = []base16Accent{
+	{"base08", "red", 29},
+	{"base09", "orange", 56},
+	{"base0A", "yellow", 100},
+	{"base0B", "green", 142},
+	{"base0C", "cyan", 195},
+	{"base0D", "blue", 264},
+	{"base0E", "magenta", 328},
+	{"base0F", "brown", 50},
+}
+
+// base16RampSteps place base00 to base07 between the background and the
+// opposite end of the lightness range, base05 being the foreground.
+var base16RampSteps = [8]float64{0, 0.08, 0.17, 0.38, 0.62, 0.82, 0.91, 1}
+
+// base16Scheme maps base00 to base0F to colors.
+type base16Scheme map[string]colorful.Color
+
+func hueDistance(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	return math.Min(d, 360-d)
+}
+
+// newBase16Scheme assigns the ramp by lightness and the accents by hue,
+// filling missing accents from the median of those found.
+func newBase16Scheme(candidates []extractedColor, variant string, minimumContrast float64) (base16Scheme, error) {
+	if variant != "dark" && variant != "light" {
+		return nil, fmt.Errorf("unknown variant %q, expected dark or light", variant)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no candidate colors")
+	}
+
+	byLightness := make([]extractedColor, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.Coverage >= backgroundMinimumCoverage {
+			byLightness = append(byLightness, candidate)
+		}
+	}
+	if len(byLightness) == 0 {
+		byLightness = candidates
+	}
+	sort.SliceStable(byLightness, func(i, j int) bool {
+		li, _, _ := okLch(byLightness[i].Color)
+		lj, _, _ := okLch(byLightness[j].Color)
+		return li < lj
+	})
+	background, opposite := byLightness[0].Color, byLightness[len(byLightness)-1].Color
+	if variant == "light" {
+		background, opposite = opposite, background
+	}
+
+	scheme := base16Scheme{}
+	background, opposite = base16Ends(background, opposite, variant, minimumContrast)
+	for i, step := range base16RampSteps {
+		scheme[fmt.Sprintf("base%02X", i)] = blendOkLab(background, opposite, step).Clamped()
+	}
+
+	// The ends alone cannot reach high targets, base05 sitting short of the
+	// opposite end: move it and the lighter steps after it.
+	for _, key := range []string{"base05", "base06", "base07"} {
+		scheme[key] = withContrast(scheme[key], scheme["base00"], minimumContrast)
+	}
+	if contrast := wcagContrast(scheme["base05"], scheme["base00"]); !meetsContrast(contrast, minimumContrast) {
+		return nil, fmt.Errorf("base05 reaches a contrast of %.2f against base00 at most, below the minimum of %g", contrast, minimumContrast)
+	}
+
+	assignBase16Accents(scheme, candidates, variant)
+	for _, accent := range base16Accents {
+		scheme[accent.Key] = withContrast(scheme[accent.Key], scheme["base00"], accentMinimumContrast)
+	}
+	return scheme, nil
+}
+
+// base16Ends pushes the ends of the ramp apart in lightness until base05 has
+// minimum contrast against base00, or black and white are reached.
+func base16Ends(background, opposite colorful.Color, variant string, minimum float64) (colorful.Color, colorful.Color) {
+	for i := 0; i < 100; i++ {
+		foreground := blendOkLab(background, opposite, base16RampSteps[5]).Clamped()
+		if meetsContrast(wcagContrast(foreground, background), minimum) {
+			break
+		}
+
+		bl, bc, bh := okLch(background)
+		ol, oc, oh := okLch(opposite)
+		direction := 0.01
+		if variant == "light" {
+			direction = -direction
+		}
+		bl = math.Max(0, math.Min(1, bl-direction))
+		ol = math.Max(0, math.Min(1, ol+direction))
+		background, opposite = fromOkLchInGamut(bl, bc, bh), fromOkLchInGamut(ol, oc, oh)
+	}
+	return background, opposite
+}
+
+// assignBase16Accents matches chromatic candidates off the ramp to accent
+// slots, closest hues first. Brown takes the darkest orange left.
+func assignBase16Accents(scheme base16Scheme, candidates []extractedColor, variant string) {
+	candidates = withoutRampColors(candidates, scheme)
+
+	type match struct {
+		slot, candidate int
+		distance        float64
+	}
+	var matches []match
+	for c, candidate := range candidates {
+		_, chroma, hue := okLch(candidate.Color)
+		if chroma < accentMinimumChroma {
+			continue
+		}
+		for s, accent := range base16Accents[:7] {
+			if distance := hueDistance(hue, accent.Hue); distance <= accentHueTolerance {
+				matches = append(matches, match{slot: s, candidate: c, distance: distance})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+
+	used := map[int]bool{}
+	assigned := map[string]colorful.Color{}
+	for _, m := range matches {
+		key := base16Accents[m.slot].Key
+		if _, ok := assigned[key]; ok || used[m.candidate] {
+			continue
+		}
+		assigned[key] = candidates[m.candidate].Color
+		used[m.candidate] = true
+	}
+
+	brownHue := base16Accents[7].Hue
+	for c, candidate := range candidates {
+		l, chroma, hue := okLch(candidate.Color)
+		if used[c] || chroma < accentMinimumChroma || hueDistance(hue, brownHue) > accentHueTolerance {
+			continue
+		}
+		if brown, ok := assigned["base0F"]; ok {
+			if brownLightness, _, _ := okLch(brown); brownLightness <= l {
+				continue
+			}
+		}
+		assigned["base0F"] = candidate.Color
+	}
+
+	// Missing accents borrow the median lightness and chroma of those found.
+	var lightnesses, chromas []float64
+	for _, c := range assigned {
+		l, chroma, _ := okLch(c)
+		lightnesses = append(lightnesses, l)
+		chromas = append(chromas, chroma)
+	}
+	lightness, chroma := 0.72, 0.13
+	if variant == "light" {
+		lightness = 0.55
+	}
+	if len(assigned) > 0 {
+		lightness, chroma = median(lightnesses), median(chromas)
+	}
+
+	for _, accent := range base16Accents {
+		if c, ok := assigned[accent.Key]; ok {
+			scheme[accent.Key] = c
+			continue
+		}
+		l, c := lightness, chroma
+		if accent.Name == "brown" {
+			l, c = l*0.75, c*0.7
+		}
+		scheme[accent.Key] = fromOkLchInGamut(l, c, accent.Hue)
+	}
+}
+
+func withoutRampColors(candidates []extractedColor, scheme base16Scheme) []extractedColor {
+	kept := make([]extractedColor, 0, len(candidates))
+	for _, candidate := range candidates {
+		inRamp := false
+		for i := range base16RampSteps {
+			inRamp = inRamp || distanceOkLab(candidate.Color, scheme[fmt.Sprintf("base%02X", i)]) < accentMinimumRampDistance
+		}
+		if !inRamp {
+			kept = append(kept, candidate)
+		}
+	}
+	return kept
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
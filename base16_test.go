@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// testBase16Candidates are a navy background, a saturated yellow as the
+// lightest color, and a red and a green accent.
+func testBase16Candidates() []extractedColor {
+	hex := func(s string) colorful.Color {
+		c, _ := colorful.Hex(s)
+		return c
+	}
+	return []extractedColor{
+		{Color: hex("#141932"), Coverage: 0.5},
+		{Color: hex("#fae15a"), Coverage: 0.25},
+		{Color: hex("#c82828"), Coverage: 0.15},
+		{Color: hex("#28a03c"), Coverage: 0.1},
+	}
+}
+
+func TestBase16SchemeRoles(t *testing.T) {
+	for _, variant := range []string{"dark", "light"} {
+		for _, minimumContrast := range []float64{4.5, 21} {
+			name := fmt.Sprintf("%s at %g", variant, minimumContrast)
+			scheme, err := newBase16Scheme(testBase16Candidates(), variant, minimumContrast)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			if contrast := wcagContrast(scheme["base05"], scheme["base00"]); !meetsContrast(contrast, minimumContrast) {
+				t.Errorf("%s: base05 has contrast %.2f against base00", name, contrast)
+			}
+			l00, _, _ := okLch(scheme["base00"])
+			l07, _, _ := okLch(scheme["base07"])
+			if (variant == "dark") != (l00 < l07) {
+				t.Errorf("%s: base00 has lightness %.2f and base07 %.2f", name, l00, l07)
+			}
+
+			for _, accent := range base16Accents {
+				if contrast := wcagContrast(scheme[accent.Key], scheme["base00"]); !meetsContrast(contrast, accentMinimumContrast) {
+					t.Errorf("%s: %s has contrast %.2f against base00", name, accent.Key, contrast)
+				}
+				for _, end := range []string{"base00", "base07"} {
+					if scheme[accent.Key].Hex() == scheme[end].Hex() {
+						t.Errorf("%s: %s is %s, the same as %s", name, accent.Key, scheme[accent.Key].Hex(), end)
+					}
+				}
+			}
+		}
+	}
+
+	scheme, err := newBase16Scheme(testBase16Candidates(), "dark", 4.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, hue := range map[string]float64{"base08": 29, "base0B": 142} {
+		if _, _, got := okLch(scheme[key]); hueDistance(got, hue) > accentHueTolerance {
+			t.Errorf("%s has hue %.0f, want about %.0f", key, got, hue)
+		}
+	}
+	if _, err := newBase16Scheme(testBase16Candidates(), "dim", 4.5); err == nil {
+		t.Error("an unknown variant was accepted")
+	}
+}
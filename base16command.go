@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const base16Candidates = 16
+
+var base16Command = &cli.Command{
+	Name:  "base16",
+	Usage: "Generate a base16 scheme from an image, assigning background, foreground and accent roles.\nExample usage: img2theme base16 <wallpaper.jpg >scheme.yaml",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "variant",
+			Usage: "dark or light background",
+			Value: "dark",
+		},
+		&cli.Float64Flag{
+			Name:  "min-contrast",
+			Usage: "WCAG contrast ratio base05, the foreground, must reach against base00, the background",
+			Value: 4.5,
+		},
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "scheme name, the input file name by default",
+		},
+		&cli.StringFlag{
+			Name:    "input",
+			Aliases: []string{"i"},
+			Usage:   "read the image from `FILE` instead of stdin",
+		},
+	},
+	Action: base16Action,
+}
+
+func base16Action(c *cli.Context) error {
+	if c.Float64("min-contrast") < 1 || c.Float64("min-contrast") > 21 {
+		return fmt.Errorf("--min-contrast must be between 1 and 21, got %v", c.Float64("min-contrast"))
+	}
+
+	var input io.Reader = os.Stdin
+	name := "img2theme"
+	if c.String("input") != "" {
+		file, err := os.Open(c.String("input"))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+		name = strings.TrimSuffix(filepath.Base(c.String("input")), filepath.Ext(c.String("input")))
+	}
+	if c.String("name") != "" {
+		name = c.String("name")
+	}
+
+	img, err := loadImageFromFile(input)
+	if err != nil {
+		return err
+	}
+	colors := colorHistogram(img)
+	if len(colors) == 0 {
+		return fmt.Errorf("the image has no opaque pixels")
+	}
+
+	candidates := extractPalette(colors, base16Candidates, nil, kMeans(true), extractOptions{
+		Space:  "oklab",
+		Random: rand.New(rand.NewSource(1)),
+	})
+	scheme, err := newBase16Scheme(candidates, c.String("variant"), c.Float64("min-contrast"))
+	if err != nil {
+		return err
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(output, "scheme: %q\nauthor: \"img2theme\"\n", name)
+	for i := 0; i < 16; i++ {
+		key := fmt.Sprintf("base%02X", i)
+		fmt.Fprintf(output, "%s: \"%s\"\n", key, strings.TrimPrefix(scheme[key].Hex(), "#"))
+	}
+	return output.Flush()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var benchCommand = &cli.Command{
+	Name:      "bench",
+	Usage:     "Measure mapping throughput on synthetic images across settings variants and cpu counts.\nExample usage: img2theme bench --sizes 1920x1080,3840x2160 --cpu-counts 1,4 settings.yaml",
+	ArgsUsage: "[settings.yaml...]",
+	Flags: append(settingsFlags(),
+		&cli.StringFlag{
+			Name:  "sizes",
+			Usage: "comma separated `WIDTHxHEIGHT` list of image sizes",
+			Value: "1920x1080",
+		},
+		&cli.StringFlag{
+			Name:  "workloads",
+			Usage: "comma separated list of synthetic images: gradient, noise, photo",
+			Value: strings.Join(syntheticWorkloads, ","),
+		},
+		&cli.StringFlag{
+			Name:  "cpu-counts",
+			Usage: "comma separated list of worker counts, 0 -> all available",
+			Value: "1,0",
+		},
+		&cli.StringFlag{
+			Name:  "variants",
+			Usage: "YAML `FILE` with a list of settings overrides to compare, each optionally named with a name key",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: table or json",
+			Value: "table",
+		},
+	),
+	Action: benchAction,
+}
+
+type benchVariant struct {
+	Name     string
+	Settings Settings
+}
+
+type benchResult struct {
+	Workload         string  `json:"workload"`
+	Size             string  `json:"size"`
+	Variant          string  `json:"variant"`
+	Cpus             int     `json:"cpus"`
+	Seconds          float64 `json:"seconds"`
+	MegapixelsPerSec float64 `json:"megapixels_per_second"`
+	Allocs           uint64  `json:"allocs"`
+	AllocBytes       uint64  `json:"alloc_bytes"`
+	CacheHitRate     float64 `json:"cache_hit_rate"`
+}
+
+// defaultBenchVariants compare the color cache configurations when no
+// variants file is given.
+const defaultBenchVariants = `
+- name: default
+- name: 6-bit-cache-keys
+  color-cache-key-bits: 6
+- name: small-random-cache
+  color-cache-size: 4096
+  color-cache-eviction: random
+`
+
+// applySettingsOverride decodes a partial settings mapping on top of a copy
+// of base, so only the keys present in override change.
+func applySettingsOverride(base Settings, override *yaml.Node) (Settings, error) {
+	settings := base
+	if err := decodeYamlNode(override, &settings); err != nil {
+		return Settings{}, err
+	}
+	settings.locatePalettes("")
+	if problems := settings.resolvePalettes(); len(problems) > 0 {
+		return Settings{}, &SettingsError{Problems: problems}
+	}
+	return settings, nil
+}
+
+func loadBenchVariants(base Settings, variantsFilePath string) ([]benchVariant, error) {
+	rawVariants := []byte(defaultBenchVariants)
+	if variantsFilePath != "" {
+		var err error
+		rawVariants, err = os.ReadFile(variantsFilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list, err := parseYamlDocument(rawVariants)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return nil, errors.New("expected a list of variants")
+	}
+
+	variants := make([]benchVariant, 0, len(list.Content))
+	for i, item := range list.Content {
+		item = resolveYamlAlias(item)
+		if item.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("variant %d: expected a mapping of settings", i)
+		}
+
+		name := "variant-" + strconv.Itoa(i)
+		override := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			if item.Content[j].Value == "name" {
+				name = item.Content[j+1].Value
+				continue
+			}
+			override.Content = append(override.Content, item.Content[j], item.Content[j+1])
+		}
+
+		settings, err := applySettingsOverride(base, override)
+		if err != nil {
+			return nil, fmt.Errorf("variant %s: %w", name, err)
+		}
+		if problems := validateSettings(settings); len(problems) > 0 {
+			for i := range problems {
+				problems[i].Source = "variant " + name
+			}
+			return nil, &SettingsError{Problems: problems}
+		}
+		variants = append(variants, benchVariant{Name: name, Settings: settings})
+	}
+
+	return variants, nil
+}
+
+func parseIntList(raw string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(raw, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in %q", field, raw)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func runBenchmark(settings Settings, img image.Image, cpus int) (benchResult, error) {
+	mapper, err := NewImageMapper(settings, img)
+	if err != nil {
+		return benchResult{}, err
+	}
+
+	pool := newWorkerPool(cpus)
+	defer pool.Close()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	mapper.QuantizeColorsToPalette(pool)
+
+	elapsed := time.Since(start).Seconds()
+	runtime.ReadMemStats(&after)
+
+	megapixels := float64(img.Bounds().Dx()*img.Bounds().Dy()) / 1e6
+	return benchResult{
+		Cpus:             cpus,
+		Seconds:          elapsed,
+		MegapixelsPerSec: megapixels / elapsed,
+		Allocs:           after.Mallocs - before.Mallocs,
+		AllocBytes:       after.TotalAlloc - before.TotalAlloc,
+		CacheHitRate:     mapper.ColorCache.Stats().HitRate(),
+	}, nil
+}
+
+func benchAction(c *cli.Context) error {
+	settings, err := loadSettings(c)
+	if err != nil {
+		return err
+	}
+
+	variants, err := loadBenchVariants(settings, c.String("variants"))
+	if err != nil {
+		return err
+	}
+
+	cpuCounts, err := parseIntList(c.String("cpu-counts"))
+	if err != nil {
+		return err
+	}
+
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unknown format %q, expected table or json", format)
+	}
+
+	var results []benchResult
+	for _, rawSize := range strings.Split(c.String("sizes"), ",") {
+		size, err := parseDimensions(rawSize)
+		if err != nil {
+			return err
+		}
+		if size.X == 0 || size.Y == 0 {
+			return fmt.Errorf("benchmark size %q needs both a width and a height", rawSize)
+		}
+
+		for _, workload := range strings.Split(c.String("workloads"), ",") {
+			img, err := generateSyntheticImage(workload, size, 1)
+			if err != nil {
+				return err
+			}
+
+			for _, variant := range variants {
+				for _, cpus := range cpuCounts {
+					result, err := runBenchmark(variant.Settings, img, availableCPUs(cpus))
+					if err != nil {
+						return fmt.Errorf("variant %s: %w", variant.Name, err)
+					}
+					result.Workload = workload
+					result.Size = fmt.Sprintf("%dx%d", size.X, size.Y)
+					result.Variant = variant.Name
+					results = append(results, result)
+				}
+			}
+		}
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "WORKLOAD\tSIZE\tVARIANT\tCPUS\tMP/S\tALLOCS\tALLOCATED\tCACHE HITS")
+	for _, result := range results {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%.2f\t%d\t%s\t%.1f%%\n",
+			result.Workload, result.Size, result.Variant, result.Cpus, result.MegapixelsPerSec,
+			result.Allocs, ByteSize(result.AllocBytes), result.CacheHitRate*100)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize is an amount of memory or disk space. In YAML it is either a plain
+// number of bytes or a number with a unit such as 512MiB or 2GB.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"TB", 1e12},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+	{"B", 1},
+}
+
+// byteSizePattern is what parseByteSize accepts, in character classes since
+// JSON schema patterns take no case flag.
+var byteSizePattern = func() string {
+	suffixes := make([]string, len(byteSizeUnits))
+	for i, unit := range byteSizeUnits {
+		var suffix strings.Builder
+		for _, r := range unit.suffix {
+			fmt.Fprintf(&suffix, "[%c%c]", unicode.ToUpper(r), unicode.ToLower(r))
+		}
+		suffixes[i] = suffix.String()
+	}
+	return `^\s*([0-9]+\.?[0-9]*|\.[0-9]+)\s*(` + strings.Join(suffixes, "|") + `)?\s*$`
+}()
+
+var byteSizeRegexp = regexp.MustCompile(byteSizePattern)
+
+func parseByteSize(raw string) (ByteSize, error) {
+	match := byteSizeRegexp.FindStringSubmatch(raw)
+	if match == nil {
+		return 0, fmt.Errorf("invalid byte size %q", raw)
+	}
+
+	multiplier := 1.0
+	for _, unit := range byteSizeUnits {
+		if strings.EqualFold(match[2], unit.suffix) {
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", raw)
+	}
+
+	return ByteSize(value * multiplier), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return yamlNodeErrorf(node, "expected a byte size, got %s", describeYamlNode(node))
+	}
+	size, err := parseByteSize(node.Value)
+	if err != nil {
+		return yamlNodeErrorf(node, "%v", err)
+	}
+	*b = size
+	return nil
+}
+
+func (b ByteSize) String() string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(b)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%dB", int64(b))
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
+
+func (b ByteSize) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type":    []string{"integer", "string"},
+		"minimum": 0,
+		"pattern": byteSizePattern,
+	}
+}
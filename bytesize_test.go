@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	for raw, want := range map[string]ByteSize{
+		"0":       0,
+		"1024":    1024,
+		"512MiB":  512 << 20,
+		"512mib":  512 << 20,
+		"2GB":     2e9,
+		" 1.5 K ": 1536,
+		".5GiB":   1 << 29,
+		"3T":      3 << 40,
+		"100B":    100,
+		"1KB":     1000,
+	} {
+		got, err := parseByteSize(raw)
+		if err != nil {
+			t.Errorf("%q: %v", raw, err)
+		} else if got != want {
+			t.Errorf("%q: got %d, want %d", raw, got, want)
+		}
+	}
+
+	for _, raw := range []string{"", "MiB", "-1", "1.2.3", "12 parsecs", "1e9"} {
+		if _, err := parseByteSize(raw); err == nil {
+			t.Errorf("%q parsed", raw)
+		}
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	for size, want := range map[ByteSize]string{
+		0:         "0B",
+		1023:      "1023B",
+		1536:      "1.5KiB",
+		512 << 20: "512.0MiB",
+	} {
+		if got := size.String(); got != want {
+			t.Errorf("%d: got %q, want %q", int64(size), got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+var cacheCommand = &cli.Command{
+	Name:  "cache",
+	Usage: "Inspect and trim the on-disk result cache enabled by the result-cache setting",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "stats",
+			Usage:  "Print the location, entry and output stamp counts and size of the result cache",
+			Action: cacheStatsAction,
+		},
+		{
+			Name:  "prune",
+			Usage: "Remove the least recently used results until the cache fits the size limit",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "max-size",
+					Usage: "size to prune the cache down to, e.g. 256MiB or 0 to empty it",
+					Value: defaultResultCacheMaxSize.String(),
+				},
+			},
+			Action: cachePruneAction,
+		},
+	},
+}
+
+func cacheStatsAction(c *cli.Context) error {
+	resultCache, err := NewResultCache(0)
+	if err != nil {
+		return err
+	}
+
+	stats, err := resultCache.Stats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("directory: %s\nentries:   %d\nstamps:    %d\nsize:      %s\n", resultCache.Dir, stats.Entries, stats.Stamps, stats.Size)
+	return nil
+}
+
+func cachePruneAction(c *cli.Context) error {
+	maxSize, err := parseByteSize(c.String("max-size"))
+	if err != nil {
+		return err
+	}
+
+	resultCache, err := NewResultCache(maxSize)
+	if err != nil {
+		return err
+	}
+
+	removed, freed, err := resultCache.Prune(maxSize)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("removed %d entries, freed %s\n", removed, freed)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// catalogFS holds the built-in palettes, one list of named entries per file.
+//
+//go:embed catalog/*.yaml
+var catalogFS embed.FS
+
+// catalogPaletteNames lists the built-in palettes, sorted.
+func catalogPaletteNames() []string {
+	files, _ := catalogFS.ReadDir("catalog")
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(file.Name(), path.Ext(file.Name())))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadCatalogPalette returns a built-in palette, or false if there is none
+// by that name.
+func loadCatalogPalette(name string) (Palette, bool, error) {
+	rawPalette, err := catalogFS.ReadFile(path.Join("catalog", name+".yaml"))
+	if err != nil {
+		return nil, false, nil
+	}
+
+	palette, err := readYamlPalette(rawPalette)
+	if err != nil {
+		return nil, true, fmt.Errorf("catalog/%s.yaml: %w", name, err)
+	}
+	return palette, true, nil
+}
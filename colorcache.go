@@ -0,0 +1,259 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"image/color"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	colorCacheShardBits       = 6
+	colorCacheShardCount      = 1 << colorCacheShardBits
+	defaultColorCacheSize     = 1 << 20
+	defaultColorCacheEviction = "lru"
+	defaultColorCacheKeyBits  = 8
+	// tileColorCacheBits sizes the direct-mapped cache every tile keeps in
+	// front of the shared one, so colors repeating within a tile are found
+	// without taking a shard lock.
+	tileColorCacheBits = 12
+)
+
+// ColorCache remembers which palette entry a source color was mapped to,
+// keyed by its RGBA value truncated to the configured bits.
+type ColorCache struct {
+	shards    [colorCacheShardCount]colorCacheShard
+	keyMask   uint32
+	keyCenter uint32
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+	// tiles keeps the tileColorCaches of finished tiles for the next ones,
+	// their entries stay valid.
+	tiles sync.Pool
+}
+
+type colorCacheShard struct {
+	mu       sync.Mutex
+	capacity int
+	lru      bool
+	entries  map[uint32]*list.Element
+	order    *list.List
+}
+
+type colorCacheEntry struct {
+	key   uint32
+	index int
+}
+
+type ColorCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+func (s ColorCacheStats) HitRate() float64 {
+	lookups := s.Hits + s.Misses
+	if lookups == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(lookups)
+}
+
+func NewColorCache(size int, eviction string, keyBits int) (*ColorCache, error) {
+	if size == 0 {
+		size = defaultColorCacheSize
+	}
+	if eviction == "" {
+		eviction = defaultColorCacheEviction
+	}
+	if keyBits == 0 {
+		keyBits = defaultColorCacheKeyBits
+	}
+
+	if size < 0 {
+		return nil, fmt.Errorf("color cache size must not be negative, got %d", size)
+	}
+	if eviction != "lru" && eviction != "random" {
+		return nil, fmt.Errorf("unknown color cache eviction policy %q, expected lru or random", eviction)
+	}
+	if keyBits < 1 || keyBits > 8 {
+		return nil, fmt.Errorf("color cache key bits must be between 1 and 8, got %d", keyBits)
+	}
+
+	channelMask := uint32(0xff) &^ (uint32(0xff) >> keyBits)
+	channelCenter := (uint32(0xff) >> keyBits) / 2
+	cache := &ColorCache{
+		keyMask:   channelMask<<24 | channelMask<<16 | channelMask<<8 | channelMask,
+		keyCenter: channelCenter<<24 | channelCenter<<16 | channelCenter<<8 | channelCenter,
+	}
+
+	shardCapacity := (size + colorCacheShardCount - 1) / colorCacheShardCount
+	for i := range cache.shards {
+		cache.shards[i] = colorCacheShard{
+			capacity: shardCapacity,
+			lru:      eviction == "lru",
+			entries:  make(map[uint32]*list.Element),
+			order:    list.New(),
+		}
+	}
+
+	return cache, nil
+}
+
+func packRGBA(c color.Color) uint32 {
+	r, g, b, a := c.RGBA()
+	return (r>>8)<<24 | (g>>8)<<16 | (b>>8)<<8 | a>>8
+}
+
+func (cc *ColorCache) Key(c color.Color) uint32 {
+	return packRGBA(c) & cc.keyMask
+}
+
+// KeyColor returns the center of the bucket of colors sharing key, so matches
+// do not depend on which pixel missed first.
+func (cc *ColorCache) KeyColor(key uint32) colorful.Color {
+	key |= cc.keyCenter
+	return colorful.Color{
+		R: float64(key>>24) / 255,
+		G: float64(key>>16&0xff) / 255,
+		B: float64(key>>8&0xff) / 255,
+	}
+}
+
+func (cc *ColorCache) shard(key uint32) *colorCacheShard {
+	// Fibonacci hashing spreads neighbouring colors across shards.
+	return &cc.shards[(key*0x9e3779b1)>>(32-colorCacheShardBits)]
+}
+
+// Get looks key up without counting the lookup, tileColorCache counts them
+// in bulk.
+func (cc *ColorCache) Get(key uint32) (int, bool) {
+	shard := cc.shard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	element, ok := shard.entries[key]
+	if !ok {
+		return 0, false
+	}
+	if shard.lru {
+		shard.order.MoveToFront(element)
+	}
+	return element.Value.(colorCacheEntry).index, true
+}
+
+func (cc *ColorCache) Put(key uint32, index int) {
+	shard := cc.shard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, ok := shard.entries[key]; ok {
+		return
+	}
+
+	if len(shard.entries) >= shard.capacity {
+		if shard.capacity == 0 {
+			return
+		}
+		cc.evict(shard)
+	}
+
+	shard.entries[key] = shard.order.PushFront(colorCacheEntry{key: key, index: index})
+}
+
+// evict drops the least recently used entry of an lru shard, or whichever
+// entry the map iteration yields first for a random shard.
+func (cc *ColorCache) evict(shard *colorCacheShard) {
+	var victim *list.Element
+	if shard.lru {
+		victim = shard.order.Back()
+	} else {
+		for _, element := range shard.entries {
+			victim = element
+			break
+		}
+	}
+
+	shard.order.Remove(victim)
+	delete(shard.entries, victim.Value.(colorCacheEntry).key)
+	cc.evictions.Add(1)
+}
+
+// tileColorCache is owned by one tile at a time and needs no locking. Its
+// misses fall through to the shared cache.
+type tileColorCache struct {
+	shared       *ColorCache
+	slots        [1 << tileColorCacheBits]tileColorCacheSlot
+	hits, misses uint64
+}
+
+type tileColorCacheSlot struct {
+	key   uint32
+	index int
+	used  bool
+}
+
+func (cc *ColorCache) forTile() *tileColorCache {
+	if tc, ok := cc.tiles.Get().(*tileColorCache); ok {
+		return tc
+	}
+	return &tileColorCache{shared: cc}
+}
+
+func (tc *tileColorCache) slot(key uint32) *tileColorCacheSlot {
+	return &tc.slots[(key*0x9e3779b1)>>(32-tileColorCacheBits)]
+}
+
+func (tc *tileColorCache) Get(key uint32) (int, bool) {
+	if slot := tc.slot(key); slot.used && slot.key == key {
+		tc.hits++
+		return slot.index, true
+	}
+
+	index, ok := tc.shared.Get(key)
+	if !ok {
+		tc.misses++
+		return 0, false
+	}
+	tc.hits++
+	*tc.slot(key) = tileColorCacheSlot{key: key, index: index, used: true}
+	return index, true
+}
+
+func (tc *tileColorCache) Put(key uint32, index int) {
+	*tc.slot(key) = tileColorCacheSlot{key: key, index: index, used: true}
+	tc.shared.Put(key, index)
+}
+
+// Release adds the lookups of the tile to the shared statistics and hands
+// the cache on to the next tile.
+func (tc *tileColorCache) Release() {
+	tc.shared.hits.Add(tc.hits)
+	tc.shared.misses.Add(tc.misses)
+	tc.hits, tc.misses = 0, 0
+	tc.shared.tiles.Put(tc)
+}
+
+func (cc *ColorCache) Stats() ColorCacheStats {
+	stats := ColorCacheStats{
+		Hits:      cc.hits.Load(),
+		Misses:    cc.misses.Load(),
+		Evictions: cc.evictions.Load(),
+	}
+
+	for i := range cc.shards {
+		cc.shards[i].mu.Lock()
+		stats.Entries += len(cc.shards[i].entries)
+		cc.shards[i].mu.Unlock()
+	}
+
+	return stats
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"image/color"
+	"sync"
+	"testing"
+)
+
+func TestColorCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := NewColorCache(colorCacheShardCount, "lru", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find three keys of the same shard, which holds a single entry.
+	var keys []uint32
+	for key := uint32(0); len(keys) < 3; key++ {
+		if cache.shard(key) == cache.shard(0) {
+			keys = append(keys, key)
+		}
+	}
+
+	cache.Put(keys[0], 0)
+	cache.Put(keys[1], 1)
+	if _, ok := cache.Get(keys[0]); ok {
+		t.Errorf("key %d survived in a full shard", keys[0])
+	}
+	if index, ok := cache.Get(keys[1]); !ok || index != 1 {
+		t.Errorf("key %d: got %d, %v, want 1, true", keys[1], index, ok)
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Entries != 1 {
+		t.Errorf("got %+v, want 1 eviction and 1 entry", stats)
+	}
+}
+
+func TestColorCacheKeyBits(t *testing.T) {
+	cache, err := NewColorCache(0, "", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := cache.Key(color.RGBA{0x12, 0x34, 0x56, 0xff})
+	b := cache.Key(color.RGBA{0x1f, 0x3f, 0x5f, 0xff})
+	c := cache.Key(color.RGBA{0x20, 0x34, 0x56, 0xff})
+	if a != b {
+		t.Errorf("colors in the same 4-bit bucket got keys %08x and %08x", a, b)
+	}
+	if a == c {
+		t.Errorf("colors in different 4-bit buckets share key %08x", a)
+	}
+	if got := cache.KeyColor(a).Hex(); got != "#173757" {
+		t.Errorf("key color: got %s, want the bucket center #173757", got)
+	}
+}
+
+func TestNewColorCacheRejects(t *testing.T) {
+	for _, test := range []struct {
+		size     int
+		eviction string
+		keyBits  int
+	}{
+		{-1, "lru", 8},
+		{0, "fifo", 8},
+		{0, "lru", 9},
+	} {
+		if _, err := NewColorCache(test.size, test.eviction, test.keyBits); err == nil {
+			t.Errorf("NewColorCache(%d, %q, %d) succeeded", test.size, test.eviction, test.keyBits)
+		}
+	}
+}
+
+func TestTileColorCacheCountsLookups(t *testing.T) {
+	cache, err := NewColorCache(0, "", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tile := cache.forTile()
+			for key := uint32(0); key < 1000; key++ {
+				if _, ok := tile.Get(key); !ok {
+					tile.Put(key, int(key%7))
+				}
+				if index, ok := tile.Get(key); !ok || index != int(key%7) {
+					t.Errorf("key %d: got %d, %v", key, index, ok)
+				}
+			}
+			tile.Release()
+		}()
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	if stats.Hits+stats.Misses != 8000 {
+		t.Errorf("counted %d lookups, want 8000", stats.Hits+stats.Misses)
+	}
+	if stats.Misses > 4000 || stats.Entries != 1000 {
+		t.Errorf("got %+v, want at most 4000 misses and 1000 entries", stats)
+	}
+}
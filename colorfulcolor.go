@@ -1,22 +1,229 @@
 package main
 
 import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/lucasb-eyer/go-colorful"
+	"gopkg.in/yaml.v3"
 )
 
 type ColorfulColor struct {
 	colorful.Color
 }
 
-func (c *ColorfulColor) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	var hex string
-	if err := unmarshal(&hex); err != nil {
-		return err
+var colorFunctionPattern = regexp.MustCompile(`^(rgba?|hsla?|oklch)\((.*)\)$`)
+
+// parseColor reads hex, 0x and integer colors, rgb(), hsl(), oklch() and CSS
+// color names. Alpha is accepted but ignored.
+func parseColor(value interface{}) (colorful.Color, error) {
+	switch value := value.(type) {
+	case int:
+		if value < 0 || value > 0xffffff {
+			return colorful.Color{}, fmt.Errorf("%#x is outside 0x000000-0xffffff", value)
+		}
+		return colorFromPackedRGB(uint32(value)), nil
+	case string:
+		return parseColorString(value)
+	}
+
+	return colorful.Color{}, fmt.Errorf("expected a color string or 0xrrggbb number, got %v", value)
+}
+
+func colorFromPackedRGB(rgb uint32) colorful.Color {
+	return colorful.Color{
+		R: float64(rgb>>16&0xff) / 255,
+		G: float64(rgb>>8&0xff) / 255,
+		B: float64(rgb&0xff) / 255,
+	}
+}
+
+func parseColorString(raw string) (colorful.Color, error) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+
+	if hex, ok := cssColorNames[value]; ok {
+		value = hex
+	}
+
+	switch {
+	case strings.HasPrefix(value, "#"):
+		return parseHexDigits(value[1:])
+	case strings.HasPrefix(value, "0x"):
+		if len(value) != 8 {
+			return colorful.Color{}, fmt.Errorf("expected 0xrrggbb")
+		}
+		return parseHexDigits(value[2:])
+	}
+
+	match := colorFunctionPattern.FindStringSubmatch(value)
+	if match == nil {
+		return colorful.Color{}, fmt.Errorf("expected a hex color, rgb(), hsl(), oklch() or a CSS color name")
+	}
+
+	arguments := strings.Fields(strings.NewReplacer(",", " ", "/", " ").Replace(match[2]))
+	if len(arguments) != 3 && len(arguments) != 4 {
+		return colorful.Color{}, fmt.Errorf("%s() takes 3 components and an optional alpha", match[1])
+	}
+	if len(arguments) == 4 {
+		if _, err := parseColorComponent(arguments[3], 1, 1); err != nil {
+			return colorful.Color{}, fmt.Errorf("alpha: %w", err)
+		}
+	}
+
+	switch match[1] {
+	case "rgb", "rgba":
+		var channels [3]float64
+		for i := range channels {
+			channel, err := parseColorComponent(arguments[i], 255, 255)
+			if err != nil {
+				return colorful.Color{}, err
+			}
+			channels[i] = channel / 255
+		}
+		return colorful.Color{R: channels[0], G: channels[1], B: channels[2]}, nil
+	case "hsl", "hsla":
+		hue, err := parseAngle(arguments[0])
+		if err != nil {
+			return colorful.Color{}, err
+		}
+		saturation, err := parseColorComponent(arguments[1], 100, 100)
+		if err != nil {
+			return colorful.Color{}, err
+		}
+		lightness, err := parseColorComponent(arguments[2], 100, 100)
+		if err != nil {
+			return colorful.Color{}, err
+		}
+		return colorful.Hsl(hue, saturation/100, lightness/100), nil
+	default:
+		lightness, err := parseColorComponent(arguments[0], 1, 1)
+		if err != nil {
+			return colorful.Color{}, err
+		}
+		chroma, err := parseColorComponent(arguments[1], 0.4, math.Inf(1))
+		if err != nil {
+			return colorful.Color{}, err
+		}
+		hue, err := parseAngle(arguments[2])
+		if err != nil {
+			return colorful.Color{}, err
+		}
+		return fromOkLch(lightness, chroma, hue).Clamped(), nil
+	}
+}
+
+func parseHexDigits(digits string) (colorful.Color, error) {
+	switch len(digits) {
+	case 3, 4:
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	case 6, 8:
+		digits = digits[:6]
+	default:
+		return colorful.Color{}, fmt.Errorf("expected 3, 4, 6 or 8 hex digits")
 	}
-	color, err := colorful.Hex(hex)
+
+	rgb, err := strconv.ParseUint(digits, 16, 32)
 	if err != nil {
+		return colorful.Color{}, fmt.Errorf("invalid hex digits")
+	}
+
+	return colorFromPackedRGB(uint32(rgb)), nil
+}
+
+// parseColorComponent reads a number, or a percentage of percentScale, and
+// checks that it lies between 0 and max.
+func parseColorComponent(raw string, percentScale, max float64) (float64, error) {
+	scale := 1.0
+	if strings.HasSuffix(raw, "%") {
+		raw = strings.TrimSuffix(raw, "%")
+		scale = percentScale / 100
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", raw)
+	}
+
+	value *= scale
+	if value < 0 || value > max {
+		return 0, fmt.Errorf("%v is outside 0-%v", value, max)
+	}
+	return value, nil
+}
+
+// parseAngle reads a hue in degrees, or with a deg, rad, grad or turn unit.
+func parseAngle(raw string) (float64, error) {
+	units := []struct {
+		suffix  string
+		degrees float64
+	}{
+		{"grad", 0.9},
+		{"deg", 1},
+		{"rad", 180 / math.Pi},
+		{"turn", 360},
+	}
+
+	scale := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(raw, unit.suffix) {
+			raw = strings.TrimSuffix(raw, unit.suffix)
+			scale = unit.degrees
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid angle %q", raw)
+	}
+
+	return math.Mod(math.Mod(value*scale, 360)+360, 360), nil
+}
+
+// formatColorValue quotes the value as it was likely written.
+func formatColorValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return strconv.Quote(value)
+	case int:
+		return strconv.Quote(fmt.Sprintf("%#x", value))
+	}
+	return fmt.Sprint(value)
+}
+
+func (c *ColorfulColor) UnmarshalYAML(node *yaml.Node) error {
+	var raw interface{}
+	if err := node.Decode(&raw); err != nil {
 		return err
 	}
+	color, err := parseColor(raw)
+	if err != nil {
+		return yamlNodeErrorf(node, "invalid color %s: %v", formatColorValue(raw), err)
+	}
 	*c = ColorfulColor{color}
 	return nil
 }
+
+func (c ColorfulColor) MarshalYAML() (interface{}, error) {
+	return c.Hex(), nil
+}
+
+func (c ColorfulColor) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "#rgb, #rgba, #rrggbb, #rrggbbaa, 0xrrggbb, rgb(), rgba(), hsl(), hsla(), oklch() or a CSS color name",
+		"anyOf": []interface{}{
+			map[string]interface{}{
+				"type":    "string",
+				"pattern": `^\s*(#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})|0[xX][0-9a-fA-F]{6}|(rgba?|hsla?|oklch)\(.*\)|[a-zA-Z]+)\s*$`,
+			},
+			map[string]interface{}{
+				"type":    "integer",
+				"minimum": 0,
+				"maximum": 0xffffff,
+			},
+		},
+	}
+}
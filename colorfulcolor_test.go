@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseColorString(t *testing.T) {
+	for raw, want := range map[string]string{
+		"#88c0d0":                      "#88c0d0",
+		"#88C0D0":                      "#88c0d0",
+		"#abc":                         "#aabbcc",
+		"#abcd":                        "#aabbcc",
+		"#88c0d080":                    "#88c0d0",
+		"0x88c0d0":                     "#88c0d0",
+		" RebeccaPurple ":              "#663399",
+		"rgb(136, 192, 208)":           "#88c0d0",
+		"rgb(100% 0% 40%)":             "#ff0066",
+		"rgba(136 192 208 / 0.5)":      "#88c0d0",
+		"hsl(120, 100%, 25%)":          "#008000",
+		"hsl(0.5turn 100% 50%)":        "#00ffff",
+		"hsla(-120deg 100% 50% / 50%)": "#0000ff",
+		"oklch(1 0 0)":                 "#ffffff",
+		"oklch(0% 0 0)":                "#000000",
+		"oklch(62.8% 0.2577 29.23)":    "#ff0000",
+	} {
+		got, err := parseColorString(raw)
+		if err != nil {
+			t.Errorf("%q: %v", raw, err)
+		} else if got.Hex() != want {
+			t.Errorf("%q: got %s, want %s", raw, got.Hex(), want)
+		}
+	}
+
+	for raw, message := range map[string]string{
+		"#12345":              "hex digits",
+		"#ggg":                "invalid hex digits",
+		"0x123":               "0xrrggbb",
+		"darkbluish":          "CSS color name",
+		"rgb(1, 2)":           "3 components",
+		"rgb(256, 0, 0)":      "outside 0-255",
+		"rgb(0, 0, 0, 2)":     "alpha",
+		"hsl(red 50% 50%)":    "invalid angle",
+		"oklch(0.5 -0.1 120)": "outside",
+		"cmyk(0, 0, 0, 0)":    "expected a hex color",
+	} {
+		if _, err := parseColorString(raw); err == nil {
+			t.Errorf("%q parsed", raw)
+		} else if !strings.Contains(err.Error(), message) {
+			t.Errorf("%q: got %q, want it to mention %q", raw, err, message)
+		}
+	}
+}
+
+func TestColorfulColorUnmarshalYAML(t *testing.T) {
+	var colors []ColorfulColor
+	if err := yaml.Unmarshal([]byte("[0x88c0d0, 8962256, '#abc', navy]"), &colors); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"#88c0d0", "#88c0d0", "#aabbcc", "#000080"} {
+		if got := colors[i].Hex(); got != want {
+			t.Errorf("[%d]: got %s, want %s", i, got, want)
+		}
+	}
+
+	for raw, message := range map[string]string{
+		"0x1000000": `invalid color "0x1000000": 0x1000000 is outside 0x000000-0xffffff`,
+		"[1, 2]":    "expected a color string or 0xrrggbb number",
+		"'#zz0000'": `invalid color "#zz0000": invalid hex digits`,
+	} {
+		var color ColorfulColor
+		if err := yaml.Unmarshal([]byte(raw), &color); err == nil {
+			t.Errorf("%s decoded", raw)
+		} else if !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: got %q, want it to mention %q", raw, err, message)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const defaultColorMetric = "cie76"
+
+// colorMetric measures how different two colors look. All metrics are on the
+// scale of go-colorful, where 0.01 is about one ΔE unit.
+type colorMetric func(a, b colorful.Color) float64
+
+var colorMetrics = map[string]colorMetric{
+	"cie76":     colorful.Color.DistanceCIE76,
+	"cie94":     colorful.Color.DistanceCIE94,
+	"ciede2000": colorful.Color.DistanceCIEDE2000,
+	"oklab":     distanceOkLab,
+}
+
+func colorMetricNames() []string {
+	names := make([]string, 0, len(colorMetrics))
+	for name := range colorMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// colorMetricByName returns the named metric, the empty name meaning the
+// default.
+func colorMetricByName(name string) (colorMetric, error) {
+	if name == "" {
+		name = defaultColorMetric
+	}
+	metric, ok := colorMetrics[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q, expected one of %s", name, strings.Join(colorMetricNames(), ", "))
+	}
+	return metric, nil
+}
+
+func distanceOkLab(a, b colorful.Color) float64 {
+	l1, a1, b1 := okLab(a)
+	l2, a2, b2 := okLab(b)
+	return math.Sqrt((l1-l2)*(l1-l2) + (a1-a2)*(a1-a2) + (b1-b2)*(b1-b2))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+func TestColorMetrics(t *testing.T) {
+	// The first pair of Sharma, Wu and Dalal's CIEDE2000 test data.
+	a := colorful.Lab(0.50, 0.026772, -0.797751)
+	b := colorful.Lab(0.50, 0, -0.827485)
+	for name, want := range map[string]float64{
+		"cie76":     0.040011,
+		"ciede2000": 0.020425,
+	} {
+		metric, err := colorMetricByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := metric(a, b); math.Abs(got-want) > 1e-5 {
+			t.Errorf("%s: got %.6f, want %.6f", name, got, want)
+		}
+	}
+
+	black, white := colorful.Color{}, colorful.Color{R: 1, G: 1, B: 1}
+	if got := distanceOkLab(black, white); math.Abs(got-1) > 1e-4 {
+		t.Errorf("oklab: black to white is %.6f, want 1", got)
+	}
+	for name, metric := range colorMetrics {
+		// CIE94 weighs by the chroma of the first color, so only it is
+		// asymmetric.
+		if got := metric(a, b); got <= 0 || name != "cie94" && got != metric(b, a) {
+			t.Errorf("%s: distance %.6f is not positive and symmetric", name, got)
+		}
+		if got := metric(a, a); got != 0 {
+			t.Errorf("%s: a color is %.6f from itself", name, got)
+		}
+	}
+}
+
+func TestColorMetricByName(t *testing.T) {
+	metric, err := colorMetricByName("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := colorful.Color{R: 1}, colorful.Color{B: 1}
+	if metric(a, b) != colorMetrics[defaultColorMetric](a, b) {
+		t.Errorf("the empty name is not %s", defaultColorMetric)
+	}
+	if _, err := colorMetricByName("cie2000"); err == nil {
+		t.Error("an unknown metric was accepted")
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const settingsEnvPrefix = "IMG2THEME_"
+
+// stringList is a YAML value that may be written as a single string or as a
+// list of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+
+	var list []string
+	if err := decodeYamlNode(node, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func (l stringList) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+}
+
+// settingsLayer is one source of settings. Layers are decoded on top of each
+// other in order, so later layers override the keys they mention.
+type settingsLayer struct {
+	Source    string
+	Raw       []byte
+	Positions *yamlPositions
+	// FromFile tells whether Positions refer to lines a user wrote.
+	FromFile bool
+}
+
+// settingsFileLayers returns the layers of a settings file: the files it
+// extends, recursively and in order, followed by the file itself.
+func settingsFileLayers(filePath string, extendedBy []string) ([]settingsLayer, error) {
+	absolutePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, ancestor := range extendedBy {
+		if ancestor == absolutePath {
+			return nil, fmt.Errorf("%s: extends itself through %s", filePath, strings.Join(extendedBy, " -> "))
+		}
+	}
+
+	rawSettings, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		Extends stringList `yaml:"extends"`
+	}
+	if err := yaml.Unmarshal(rawSettings, &header); err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	var layers []settingsLayer
+	for _, extended := range header.Extends {
+		if !filepath.IsAbs(extended) {
+			extended = filepath.Join(filepath.Dir(filePath), extended)
+		}
+		extendedLayers, err := settingsFileLayers(extended, append(extendedBy, absolutePath))
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, extendedLayers...)
+	}
+
+	return append(layers, settingsLayer{
+		Source:    filePath,
+		Raw:       rawSettings,
+		Positions: newYamlPositions(rawSettings),
+		FromFile:  true,
+	}), nil
+}
+
+// settingsOverrideLayer builds a layer setting one dotted key to a YAML value,
+// or to a plain string when it does not parse as one.
+func settingsOverrideLayer(source, key, rawValue string) (settingsLayer, error) {
+	var value interface{} = rawValue
+	if !strings.HasPrefix(strings.TrimSpace(rawValue), "#") {
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(rawValue), &parsed); err == nil && parsed != nil {
+			value = parsed
+		}
+	}
+
+	keys := strings.Split(key, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		value = map[string]interface{}{keys[i]: value}
+	}
+
+	raw, err := yaml.Marshal(value)
+	if err != nil {
+		return settingsLayer{}, err
+	}
+
+	return settingsLayer{Source: source, Raw: raw, Positions: newYamlPositions(raw)}, nil
+}
+
+// settingsEnvLayers turns IMG2THEME_PALETTE_AFFINITY=0.7 style environment
+// variables into layers.
+func settingsEnvLayers(environ []string) ([]settingsLayer, error) {
+	var layers []settingsLayer
+
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, settingsEnvPrefix) {
+			continue
+		}
+
+		key := strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(name, settingsEnvPrefix)), "_", "-")
+		layer, err := settingsOverrideLayer(name, key, value)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+// mergeSettingsLayers decodes the layers in order, then resolves and validates
+// the result, blaming each problem on the last layer setting its key.
+func mergeSettingsLayers(layers []settingsLayer) (Settings, error) {
+	settings := Settings{}
+	var problems []SettingsProblem
+
+	for _, layer := range layers {
+		node, err := parseYamlDocument(layer.Raw)
+		if err != nil {
+			return Settings{}, fmt.Errorf("%s: %w", layer.Source, err)
+		}
+
+		var layerProblems []SettingsProblem
+		if node != nil {
+			var errs yamlNodeErrors
+			errors.As(decodeYamlNode(node, &settings), &errs)
+			for _, err := range errs {
+				layerProblems = append(layerProblems, SettingsProblem{
+					Source:  layer.Source,
+					Path:    err.Path,
+					Line:    err.Node.Line,
+					Column:  err.Node.Column,
+					Message: err.Message,
+				})
+			}
+		}
+
+		baseDir := ""
+		if layer.FromFile {
+			baseDir = filepath.Dir(layer.Source)
+		}
+		settings.locatePalettes(baseDir)
+
+		layerProblems = withoutAnchorDefinitions(layerProblems, layer.Positions)
+		if !layer.FromFile {
+			for i := range layerProblems {
+				layerProblems[i].Line, layerProblems[i].Column = 0, 0
+			}
+		}
+		sortSettingsProblems(layerProblems)
+		problems = append(problems, layerProblems...)
+	}
+	settings.Extends = nil
+
+	// Palettes are only resolved once merged, so that the ones overridden by
+	// later layers are never loaded and the terminal is queried at most once.
+	problems = appendMergedProblems(problems, settings.resolvePalettes(), layers)
+	problems = appendMergedProblems(problems, validateSettings(settings), layers)
+
+	if len(problems) > 0 {
+		return Settings{}, &SettingsError{Problems: problems}
+	}
+
+	return settings, nil
+}
+
+// appendMergedProblems appends the problems found in the merged settings,
+// each attributed to the last layer that set its key.
+func appendMergedProblems(problems, merged []SettingsProblem, layers []settingsLayer) []SettingsProblem {
+	var located []SettingsProblem
+	for _, problem := range merged {
+		if hasProblemWithin(problems, problem.Path) {
+			// A value that failed to decode or resolve was left out, don't
+			// blame it twice.
+			continue
+		}
+
+		problem.Source = "settings"
+		for i := len(layers) - 1; i >= 0; i-- {
+			position, ok := layers[i].Positions.Lookup(problem.Path)
+			if !ok {
+				continue
+			}
+
+			problem.Source = layers[i].Source
+			if layers[i].FromFile {
+				problem.Line, problem.Column = position.Line, position.Column
+			}
+			break
+		}
+		located = append(located, problem)
+	}
+	sortSettingsProblems(located)
+	return append(problems, located...)
+}
+
+// settingFields lists the top level settings that get a flag of their own,
+// leaving out the ones that are only practical to write in a file.
+func settingFields() []reflect.StructField {
+	var fields []reflect.StructField
+
+	settingsType := reflect.TypeOf(Settings{})
+	for i := 0; i < settingsType.NumField(); i++ {
+		field := settingsType.Field(i)
+		if name := yamlFieldName(field); name == "extends" || name == "mappings" {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// settingsFlags are the flags every command that reads settings accepts.
+func settingsFlags() []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "profile",
+			Aliases: []string{"p"},
+			Usage:   "read the `NAME`.yaml profile from $XDG_CONFIG_HOME/img2theme before any other settings file, may be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:    "config",
+			Aliases: []string{"c"},
+			Usage:   "settings `FILE` to read, may be repeated, later files override earlier ones",
+		},
+		&cli.StringSliceFlag{
+			Name:  "set",
+			Usage: "override a setting with `KEY=VALUE`, the value is read as YAML, may be repeated",
+		},
+	}
+
+	for _, field := range settingFields() {
+		flags = append(flags, &cli.StringFlag{
+			Name:     yamlFieldName(field),
+			Usage:    field.Tag.Get("desc"),
+			Category: "settings",
+		})
+	}
+
+	return flags
+}
+
+// settingsFilesLayers reads the --profile files, the --config files and the
+// positional settings files, along with the files they extend.
+func settingsFilesLayers(c *cli.Context) ([]settingsLayer, error) {
+	var layers []settingsLayer
+	var filePaths []string
+
+	for _, profile := range c.StringSlice("profile") {
+		filePath, err := profilePath(profile)
+		if err != nil {
+			return nil, err
+		}
+		filePaths = append(filePaths, filePath)
+	}
+	filePaths = append(filePaths, c.StringSlice("config")...)
+	filePaths = append(filePaths, c.Args().Slice()...)
+
+	for _, filePath := range filePaths {
+		fileLayers, err := settingsFileLayers(filePath, nil)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, fileLayers...)
+	}
+
+	return layers, nil
+}
+
+// loadSettings merges profiles, settings files, IMG2THEME_* variables, flags
+// and --set overrides, in increasing priority.
+func loadSettings(c *cli.Context) (Settings, error) {
+	layers, err := settingsFilesLayers(c)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	envLayers, err := settingsEnvLayers(os.Environ())
+	if err != nil {
+		return Settings{}, err
+	}
+	layers = append(layers, envLayers...)
+
+	for _, field := range settingFields() {
+		name := yamlFieldName(field)
+		if !c.IsSet(name) {
+			continue
+		}
+
+		layer, err := settingsOverrideLayer("--"+name, name, c.String(name))
+		if err != nil {
+			return Settings{}, err
+		}
+		layers = append(layers, layer)
+	}
+
+	for _, override := range c.StringSlice("set") {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return Settings{}, fmt.Errorf("--set %s: expected KEY=VALUE", override)
+		}
+
+		layer, err := settingsOverrideLayer("--set "+key, strings.TrimSpace(key), value)
+		if err != nil {
+			return Settings{}, err
+		}
+		layers = append(layers, layer)
+	}
+
+	return mergeSettingsLayers(layers)
+}
+
+// withoutAnchorDefinitions drops unknown key problems of top level keys that
+// only define an anchor, like `nord: &nord [...]`.
+func withoutAnchorDefinitions(problems []SettingsProblem, positions *yamlPositions) []SettingsProblem {
+	kept := problems[:0]
+	for _, problem := range problems {
+		if problem.Message == "unknown setting" && !strings.ContainsAny(problem.Path, ".[") {
+			if anchor, ok := positions.Anchor(problem.Path); ok && anchor != "" {
+				continue
+			}
+		}
+		kept = append(kept, problem)
+	}
+	return kept
+}
+
+func hasProblemWithin(problems []SettingsProblem, path string) bool {
+	for _, problem := range problems {
+		if problem.Path == path || strings.HasPrefix(problem.Path, path+"[") || strings.HasPrefix(problem.Path, path+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// relativeLuminance is the WCAG 2 luminance of c, from 0 for black to 1 for
+// white.
+func relativeLuminance(c colorful.Color) float64 {
+	r, g, b := c.Clamped().LinearRgb()
+	return 0.2126*r + 0.7152*g + 0.0722*b
+}
+
+// wcagContrast is the WCAG 2 contrast ratio of two colors, from 1 to 21,
+// whichever is lighter.
+func wcagContrast(a, b colorful.Color) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	return (math.Max(la, lb) + 0.05) / (math.Min(la, lb) + 0.05)
+}
+
+// contrastTolerance absorbs rounding in contrast ratios, so that pure black
+// on pure white meets a minimum of 21.
+const contrastTolerance = 1e-3
+
+func meetsContrast(contrast, minimum float64) bool {
+	return contrast >= minimum-contrastTolerance
+}
+
+// withContrast changes the lightness of c as little as it takes, lighter or
+// darker, to reach minimum contrast, or keeps the best it found.
+func withContrast(c, background colorful.Color, minimum float64) colorful.Color {
+	best, bestContrast := c, wcagContrast(c, background)
+	if meetsContrast(bestContrast, minimum) {
+		return c
+	}
+
+	l, chroma, hue := okLch(c)
+	for i := 1; i <= 100; i++ {
+		step := float64(i) / 100
+		for _, lightness := range []float64{l - step, l + step} {
+			candidate := fromOkLchInGamut(math.Max(0, math.Min(1, lightness)), chroma, hue)
+			contrast := wcagContrast(candidate, background)
+			if meetsContrast(contrast, minimum) {
+				return candidate
+			}
+			if contrast > bestContrast {
+				best, bestContrast = candidate, contrast
+			}
+		}
+	}
+	return best
+}
+
+// apcaLuminance is the screen luminance APCA works with, soft clamped near
+// black.
+func apcaLuminance(c colorful.Color) float64 {
+	c = c.Clamped()
+	y := 0.2126729*math.Pow(c.R, 2.4) + 0.7151522*math.Pow(c.G, 2.4) + 0.0721750*math.Pow(c.B, 2.4)
+	if y < 0.022 {
+		y += math.Pow(0.022-y, 1.414)
+	}
+	return y
+}
+
+// apcaContrast is the APCA Lc of text on background, positive for dark text
+// on a light background.
+func apcaContrast(text, background colorful.Color) float64 {
+	textY, backgroundY := apcaLuminance(text), apcaLuminance(background)
+	if math.Abs(backgroundY-textY) < 0.0005 {
+		return 0
+	}
+
+	if backgroundY > textY {
+		contrast := (math.Pow(backgroundY, 0.56) - math.Pow(textY, 0.57)) * 1.14
+		if contrast < 0.1 {
+			return 0
+		}
+		return (contrast - 0.027) * 100
+	}
+	contrast := (math.Pow(backgroundY, 0.65) - math.Pow(textY, 0.62)) * 1.14
+	if contrast > -0.1 {
+		return 0
+	}
+	return (contrast + 0.027) * 100
+}
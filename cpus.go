@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// availableCPUs returns the number of workers to run: the requested amount, or
+// when that is 0, the number of cores allowed by the cgroup CPU quota.
+func availableCPUs(requested int) int {
+	if requested > 0 {
+		return requested
+	}
+
+	numCPU := runtime.NumCPU()
+	if quota, ok := cgroupCPUQuota(); ok && quota < float64(numCPU) {
+		return int(math.Max(1, math.Ceil(quota)))
+	}
+
+	return numCPU
+}
+
+// cgroupCPUQuota reads the CPU bandwidth limit of the current cgroup as a
+// number of cores, checking the cgroup v2 layout first and v1 after.
+func cgroupCPUQuota() (float64, bool) {
+	if raw, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		fields := strings.Fields(string(raw))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return parseCPUQuota(fields[0], fields[1])
+	}
+
+	rawQuota, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		return 0, false
+	}
+	rawPeriod, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0, false
+	}
+
+	return parseCPUQuota(strings.TrimSpace(string(rawQuota)), strings.TrimSpace(string(rawPeriod)))
+}
+
+func parseCPUQuota(rawQuota, rawPeriod string) (float64, bool) {
+	quota, err := strconv.ParseFloat(rawQuota, 64)
+	if err != nil || quota <= 0 {
+		return 0, false
+	}
+	period, err := strconv.ParseFloat(rawPeriod, 64)
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+
+	return quota / period, true
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// weightedColor is a color of an image with the number of pixels it covers.
+type weightedColor struct {
+	Color  colorful.Color
+	Weight float64
+}
+
+// extractOptions are the settings of the extraction algorithms that need
+// them: the color space k-means clusters in and its random source.
+type extractOptions struct {
+	Space  string
+	Random *rand.Rand
+}
+
+// extractAlgorithm picks up to n colors representing colors.
+type extractAlgorithm func(colors []weightedColor, n int, options extractOptions) []colorful.Color
+
+var extractAlgorithms = map[string]extractAlgorithm{
+	"median-cut": medianCut,
+	"octree":     octreeQuantize,
+	"kmeans":     kMeans(false),
+	"kmeans++":   kMeans(true),
+	"wu":         wuQuantize,
+}
+
+var extractSpaces = []string{"lab", "oklab"}
+
+func extractAlgorithmNames() []string {
+	names := make([]string, 0, len(extractAlgorithms))
+	for name := range extractAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extractedColor is a color of an extracted palette with the share of pixels
+// nearest to it.
+type extractedColor struct {
+	Color    colorful.Color
+	Coverage float64
+	Pinned   bool
+}
+
+// colorHistogram counts the opaque pixels of img in bins of 5 bits per
+// channel, each represented by the mean color of its pixels.
+func colorHistogram(img image.Image) []weightedColor {
+	type bin struct {
+		r, g, b, count uint64
+	}
+	bins := map[uint32]*bin{}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			r, g, b = r>>8, g>>8, b>>8
+
+			key := r>>3<<10 | g>>3<<5 | b>>3
+			counts, ok := bins[key]
+			if !ok {
+				counts = &bin{}
+				bins[key] = counts
+			}
+			counts.r += uint64(r)
+			counts.g += uint64(g)
+			counts.b += uint64(b)
+			counts.count++
+		}
+	}
+
+	keys := make([]uint32, 0, len(bins))
+	for key := range bins {
+		keys = append(keys, key)
+	}
+	// Sorted so that seeded algorithms see the colors in the same order.
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	colors := make([]weightedColor, len(keys))
+	for i, key := range keys {
+		counts := bins[key]
+		total := float64(counts.count)
+		colors[i] = weightedColor{
+			Color:  colorful.Color{R: float64(counts.r) / total / 255, G: float64(counts.g) / total / 255, B: float64(counts.b) / total / 255},
+			Weight: total,
+		}
+	}
+	return colors
+}
+
+// extractPalette runs algorithm for the colors pinned ones leave room for,
+// then measures how much of the image every color covers, largest first.
+func extractPalette(colors []weightedColor, n int, pinned []colorful.Color, algorithm extractAlgorithm, options extractOptions) []extractedColor {
+	var palette []extractedColor
+	for _, c := range pinned {
+		palette = append(palette, extractedColor{Color: c, Pinned: true})
+	}
+	if free := n - len(pinned); free > 0 && len(colors) > 0 {
+		for _, c := range algorithm(colors, free, options) {
+			palette = append(palette, extractedColor{Color: c.Clamped()})
+		}
+	}
+
+	var total float64
+	for _, c := range colors {
+		nearest, nearestDistance := 0, math.Inf(1)
+		for i, entry := range palette {
+			if distance := c.Color.DistanceLab(entry.Color); distance < nearestDistance {
+				nearest, nearestDistance = i, distance
+			}
+		}
+		palette[nearest].Coverage += c.Weight
+		total += c.Weight
+	}
+	for i := range palette {
+		if total > 0 {
+			palette[i].Coverage /= total
+		}
+	}
+
+	sort.SliceStable(palette, func(i, j int) bool { return palette[i].Coverage > palette[j].Coverage })
+	return palette
+}
+
+func meanColor(colors []weightedColor) colorful.Color {
+	var r, g, b, total float64
+	for _, c := range colors {
+		r += c.Color.R * c.Weight
+		g += c.Color.G * c.Weight
+		b += c.Color.B * c.Weight
+		total += c.Weight
+	}
+	return colorful.Color{R: r / total, G: g / total, B: b / total}
+}
+
+func channel(c colorful.Color, index int) float64 {
+	return [3]float64{c.R, c.G, c.B}[index]
+}
+
+// medianCut splits the box of colors with the widest channel range, weighted
+// by pixel count, at the median of that channel until there are n boxes.
+func medianCut(colors []weightedColor, n int, _ extractOptions) []colorful.Color {
+	type box struct {
+		colors  []weightedColor
+		channel int
+		score   float64
+	}
+	measure := func(colors []weightedColor) box {
+		measured := box{colors: colors}
+		var weight float64
+		for _, c := range colors {
+			weight += c.Weight
+		}
+		for ch := 0; ch < 3; ch++ {
+			low, high := math.Inf(1), math.Inf(-1)
+			for _, c := range colors {
+				low, high = math.Min(low, channel(c.Color, ch)), math.Max(high, channel(c.Color, ch))
+			}
+			if score := (high - low) * weight; score > measured.score {
+				measured.channel, measured.score = ch, score
+			}
+		}
+		return measured
+	}
+
+	boxes := []box{measure(colors)}
+	for len(boxes) < n {
+		widest := 0
+		for i, b := range boxes {
+			if b.score > boxes[widest].score {
+				widest = i
+			}
+		}
+		b := boxes[widest]
+		if b.score == 0 || len(b.colors) < 2 {
+			break
+		}
+
+		sort.Slice(b.colors, func(i, j int) bool {
+			return channel(b.colors[i].Color, b.channel) < channel(b.colors[j].Color, b.channel)
+		})
+		var weight, half float64
+		for _, c := range b.colors {
+			weight += c.Weight
+		}
+		cut := 1
+		for i, c := range b.colors[:len(b.colors)-1] {
+			half += c.Weight
+			cut = i + 1
+			if half >= weight/2 {
+				break
+			}
+		}
+
+		boxes[widest] = measure(b.colors[:cut])
+		boxes = append(boxes, measure(b.colors[cut:]))
+	}
+
+	palette := make([]colorful.Color, len(boxes))
+	for i, b := range boxes {
+		palette[i] = meanColor(b.colors)
+	}
+	return palette
+}
+
+type octreeNode struct {
+	children [8]*octreeNode
+	r, g, b  float64
+	weight   float64
+	leaf     bool
+}
+
+func (node *octreeNode) childCount() int {
+	count := 0
+	for _, child := range node.children {
+		if child != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// merge folds the children of node, all leaves, into it.
+func (node *octreeNode) merge() {
+	for i, child := range node.children {
+		if child != nil {
+			node.r += child.r
+			node.g += child.g
+			node.b += child.b
+			node.children[i] = nil
+		}
+	}
+	node.leaf = true
+}
+
+// mergeLightest folds the count children of node covering the fewest pixels,
+// all leaves, into one of them.
+func (node *octreeNode) mergeLightest(count int) {
+	var indexes []int
+	for i, child := range node.children {
+		if child != nil {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return node.children[indexes[i]].weight < node.children[indexes[j]].weight
+	})
+
+	into := node.children[indexes[0]]
+	for _, i := range indexes[1:count] {
+		child := node.children[i]
+		into.r += child.r
+		into.g += child.g
+		into.b += child.b
+		into.weight += child.weight
+		node.children[i] = nil
+	}
+}
+
+// octreeQuantize merges the deepest, least covered nodes of an 8 bit octree
+// until n leaves are left.
+func octreeQuantize(colors []weightedColor, n int, _ extractOptions) []colorful.Color {
+	const depth = 8
+	root := &octreeNode{}
+	var levels [depth][]*octreeNode
+	levels[0] = []*octreeNode{root}
+	leaves := 0
+
+	for _, c := range colors {
+		r, g, b := c.Color.RGB255()
+		node := root
+		for level := 0; level < depth; level++ {
+			node.weight += c.Weight
+			shift := depth - 1 - level
+			index := (r>>shift&1)<<2 | (g>>shift&1)<<1 | b>>shift&1
+			if node.children[index] == nil {
+				child := &octreeNode{leaf: level == depth-1}
+				node.children[index] = child
+				if child.leaf {
+					leaves++
+				} else {
+					levels[level+1] = append(levels[level+1], child)
+				}
+			}
+			node = node.children[index]
+		}
+		node.r += c.Color.R * c.Weight
+		node.g += c.Color.G * c.Weight
+		node.b += c.Color.B * c.Weight
+		node.weight += c.Weight
+	}
+
+	for level := depth - 1; level >= 0 && leaves > n; level-- {
+		nodes := levels[level]
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+		// Merges that would leave fewer than n leaves are skipped. When only
+		// those are left, just enough children of one are merged to reach n.
+		var fewest *octreeNode
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			if children := node.childCount(); leaves-(children-1) >= n {
+				node.merge()
+				leaves -= children - 1
+			} else if fewest == nil || children < fewest.childCount() {
+				fewest = node
+			}
+		}
+		if leaves > n && fewest != nil {
+			fewest.mergeLightest(leaves - n + 1)
+			leaves = n
+		}
+	}
+
+	var palette []colorful.Color
+	var collect func(node *octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			palette = append(palette, colorful.Color{R: node.r / node.weight, G: node.g / node.weight, B: node.b / node.weight})
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+	return palette
+}
+
+// toExtractSpace and fromExtractSpace convert between sRGB and the space
+// k-means clusters in.
+func toExtractSpace(c colorful.Color, space string) [3]float64 {
+	if space == "lab" {
+		l, a, b := c.Lab()
+		return [3]float64{l, a, b}
+	}
+	l, a, b := okLab(c)
+	return [3]float64{l, a, b}
+}
+
+func fromExtractSpace(point [3]float64, space string) colorful.Color {
+	if space == "lab" {
+		return colorful.Lab(point[0], point[1], point[2]).Clamped()
+	}
+	return fromOkLab(point[0], point[1], point[2]).Clamped()
+}
+
+func squaredDistance(a, b [3]float64) float64 {
+	d0, d1, d2 := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return d0*d0 + d1*d1 + d2*d2
+}
+
+const (
+	kMeansMaxIterations = 100
+	kMeansTolerance     = 1e-7
+)
+
+// kMeans clusters the colors by pixel count weighted k-means. Initial centers
+// are drawn uniformly, or by k-means++ when plusPlus is set.
+func kMeans(plusPlus bool) extractAlgorithm {
+	return func(colors []weightedColor, n int, options extractOptions) []colorful.Color {
+		points := make([][3]float64, len(colors))
+		for i, c := range colors {
+			points[i] = toExtractSpace(c.Color, options.Space)
+		}
+		if n > len(points) {
+			n = len(points)
+		}
+
+		var centers [][3]float64
+		if plusPlus {
+			centers = append(centers, points[options.Random.Intn(len(points))])
+			distances := make([]float64, len(points))
+			for len(centers) < n {
+				var total float64
+				for i, point := range points {
+					distances[i] = math.Inf(1)
+					for _, center := range centers {
+						distances[i] = math.Min(distances[i], squaredDistance(point, center))
+					}
+					distances[i] *= colors[i].Weight
+					total += distances[i]
+				}
+				if total == 0 {
+					break
+				}
+
+				target := options.Random.Float64() * total
+				chosen := len(points) - 1
+				for i, distance := range distances {
+					if target -= distance; target <= 0 {
+						chosen = i
+						break
+					}
+				}
+				centers = append(centers, points[chosen])
+			}
+		} else {
+			for _, i := range options.Random.Perm(len(points))[:n] {
+				centers = append(centers, points[i])
+			}
+		}
+
+		assignments := make([]int, len(points))
+		for iteration := 0; iteration < kMeansMaxIterations; iteration++ {
+			for i, point := range points {
+				nearestDistance := math.Inf(1)
+				for c, center := range centers {
+					if distance := squaredDistance(point, center); distance < nearestDistance {
+						assignments[i], nearestDistance = c, distance
+					}
+				}
+			}
+
+			sums := make([][3]float64, len(centers))
+			weights := make([]float64, len(centers))
+			for i, point := range points {
+				c, weight := assignments[i], colors[i].Weight
+				for d := range point {
+					sums[c][d] += point[d] * weight
+				}
+				weights[c] += weight
+			}
+
+			moved := 0.0
+			for c := range centers {
+				if weights[c] == 0 {
+					continue
+				}
+				center := [3]float64{sums[c][0] / weights[c], sums[c][1] / weights[c], sums[c][2] / weights[c]}
+				moved = math.Max(moved, squaredDistance(center, centers[c]))
+				centers[c] = center
+			}
+			if moved < kMeansTolerance {
+				break
+			}
+		}
+
+		palette := make([]colorful.Color, len(centers))
+		for i, center := range centers {
+			palette[i] = fromExtractSpace(center, options.Space)
+		}
+		return palette
+	}
+}
+
+func validateExtractSpace(space string) error {
+	for _, known := range extractSpaces {
+		if space == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown color space %q, expected one of %s", space, strings.Join(extractSpaces, ", "))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// testClusters are four well separated groups of three colors, covering the
+// image equally. Median cut splits at the weighted median, so unequal groups
+// would be cut through.
+func testClusters() (centers []colorful.Color, colors []weightedColor) {
+	centers = []colorful.Color{
+		{R: 0.8, G: 0.1, B: 0.1},
+		{R: 0.1, G: 0.7, B: 0.2},
+		{R: 0.1, G: 0.2, B: 0.8},
+		{R: 0.95, G: 0.95, B: 0.9},
+	}
+	for _, center := range centers {
+		for _, d := range []float64{-0.03, 0, 0.03} {
+			colors = append(colors, weightedColor{
+				Color:  colorful.Color{R: center.R + d, G: center.G - d, B: center.B + d/2}.Clamped(),
+				Weight: 1,
+			})
+		}
+	}
+	return centers, colors
+}
+
+func TestExtractAlgorithmsFindClusters(t *testing.T) {
+	centers, colors := testClusters()
+	for _, name := range extractAlgorithmNames() {
+		for _, space := range extractSpaces {
+			options := extractOptions{Space: space, Random: rand.New(rand.NewSource(1))}
+			palette := extractPalette(colors, len(centers), nil, extractAlgorithms[name], options)
+			if len(palette) != len(centers) {
+				t.Errorf("%s in %s: got %d colors, want %d", name, space, len(palette), len(centers))
+				continue
+			}
+
+			for _, center := range centers {
+				nearest := math.Inf(1)
+				for _, c := range palette {
+					nearest = math.Min(nearest, c.Color.DistanceLab(center))
+				}
+				if nearest > 0.05 {
+					t.Errorf("%s in %s: nothing near %s, got %v", name, space, center.Hex(), palette)
+				}
+			}
+			for _, c := range palette {
+				if math.Abs(c.Coverage-0.25) > 1e-9 {
+					t.Errorf("%s in %s: %s covers %v, want 0.25", name, space, c.Color.Hex(), c.Coverage)
+				}
+			}
+		}
+	}
+}
+
+func TestExtractPalettePinsAndSeeds(t *testing.T) {
+	_, colors := testClusters()
+	colors[0].Weight = 7
+	black := colorful.Color{}
+	palette := extractPalette(colors, 3, []colorful.Color{black}, wuQuantize, extractOptions{})
+	if len(palette) != 3 || !palette[len(palette)-1].Pinned || palette[len(palette)-1].Color != black {
+		t.Errorf("got %v, want two extracted colors and the pinned black, which covers nothing, last", palette)
+	}
+	if palette[0].Coverage < palette[1].Coverage {
+		t.Errorf("got coverages %v, want the largest first", palette)
+	}
+
+	for _, name := range []string{"kmeans", "kmeans++"} {
+		extract := func() []extractedColor {
+			options := extractOptions{Space: "oklab", Random: rand.New(rand.NewSource(7))}
+			return extractPalette(colors, 3, nil, extractAlgorithms[name], options)
+		}
+		if first, second := extract(), extract(); !reflect.DeepEqual(first, second) {
+			t.Errorf("%s: the same seed gave %v and %v", name, first, second)
+		}
+	}
+
+	if palette := extractPalette(colors[:2], 8, nil, medianCut, extractOptions{}); len(palette) > 2 {
+		t.Errorf("got %d colors out of 2", len(palette))
+	}
+}
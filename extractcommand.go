@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/urfave/cli/v2"
+)
+
+var extractCommand = &cli.Command{
+	Name:  "extract",
+	Usage: "Derive a palette from an image, written as settings YAML with the share of the image every color covers.\nExample usage: img2theme extract -n 16 <image.jpg >palette.yaml",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:    "colors",
+			Aliases: []string{"n"},
+			Usage:   "number of colors to extract, pinned ones included",
+			Value:   16,
+		},
+		&cli.StringFlag{
+			Name:    "algorithm",
+			Aliases: []string{"a"},
+			Usage:   "one of " + strings.Join(extractAlgorithmNames(), ", "),
+			Value:   "kmeans++",
+		},
+		&cli.StringFlag{
+			Name:  "space",
+			Usage: "color space k-means clusters in: " + strings.Join(extractSpaces, " or "),
+			Value: "oklab",
+		},
+		&cli.StringSliceFlag{
+			Name:  "pin",
+			Usage: "`COLOR` the palette must include, may be repeated",
+		},
+		&cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed of the random k-means initialization, the same seed gives the same palette",
+			Value: 1,
+		},
+		&cli.StringFlag{
+			Name:    "input",
+			Aliases: []string{"i"},
+			Usage:   "read the image from `FILE` instead of stdin",
+		},
+	},
+	Action: extractAction,
+}
+
+func extractAction(c *cli.Context) error {
+	n := c.Int("colors")
+	if n < 1 {
+		return fmt.Errorf("--colors must be at least 1, got %d", n)
+	}
+	algorithm, ok := extractAlgorithms[c.String("algorithm")]
+	if !ok {
+		return fmt.Errorf("unknown algorithm %q, expected one of %s", c.String("algorithm"), strings.Join(extractAlgorithmNames(), ", "))
+	}
+	if err := validateExtractSpace(c.String("space")); err != nil {
+		return err
+	}
+
+	var pinned []colorful.Color
+	for _, raw := range c.StringSlice("pin") {
+		color, err := parseColorString(raw)
+		if err != nil {
+			return fmt.Errorf("--pin %q: %w", raw, err)
+		}
+		pinned = append(pinned, color)
+	}
+	if len(pinned) > n {
+		return fmt.Errorf("%d pinned colors do not fit in %d colors", len(pinned), n)
+	}
+
+	var input io.Reader = os.Stdin
+	inputName := "stdin"
+	if c.String("input") != "" {
+		file, err := os.Open(c.String("input"))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input, inputName = file, c.String("input")
+	}
+	img, err := loadImageFromFile(input)
+	if err != nil {
+		return err
+	}
+
+	colors := colorHistogram(img)
+	if len(colors) == 0 {
+		return fmt.Errorf("%s has no opaque pixels", inputName)
+	}
+
+	palette := extractPalette(colors, n, pinned, algorithm, extractOptions{
+		Space:  c.String("space"),
+		Random: rand.New(rand.NewSource(c.Int64("seed"))),
+	})
+
+	output := bufio.NewWriter(os.Stdout)
+	description := c.String("algorithm")
+	if strings.HasPrefix(description, "kmeans") {
+		description += " in " + c.String("space") + fmt.Sprintf(", seed %d", c.Int64("seed"))
+	}
+	fmt.Fprintf(output, "# %d colors extracted from %s with %s, by share of the image\n", len(palette), inputName, description)
+	fmt.Fprintln(output, "palette:")
+	for _, color := range palette {
+		note := ""
+		if color.Pinned {
+			note = ", pinned"
+		}
+		fmt.Fprintf(output, "  - '%s'  # %.1f%%%s\n", color.Color.Hex(), color.Coverage*100, note)
+	}
+	return output.Flush()
+}
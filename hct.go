@@ -0,0 +1,189 @@
+package main
+
+import (
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// HCT is the hue, chroma and tone space of Material Design: CAM16 hue and
+// chroma under Material's default viewing conditions, and L* as tone.
+
+type cam16ViewingConditions struct {
+	n, aw, nbb, ncb, c, nc, fl, z float64
+	rgbD                          [3]float64
+}
+
+var (
+	cam16FromXyz = [3][3]float64{
+		{0.401288, 0.650173, -0.051461},
+		{-0.250268, 1.204414, 0.045854},
+		{-0.002079, 0.048952, 0.953127},
+	}
+	cam16ToXyz = [3][3]float64{
+		{1.8620678, -1.0112547, 0.14918678},
+		{0.38752654, 0.62144744, -0.00897398},
+		{-0.0158415, -0.03412294, 1.0499644},
+	}
+	defaultViewingConditions = newCam16ViewingConditions()
+)
+
+func multiply(matrix [3][3]float64, v [3]float64) [3]float64 {
+	var result [3]float64
+	for i, row := range matrix {
+		result[i] = row[0]*v[0] + row[1]*v[1] + row[2]*v[2]
+	}
+	return result
+}
+
+func yFromLstar(lstar float64) float64 {
+	_, y, _ := colorful.LabToXyz(lstar/100, 0, 0)
+	return y * 100
+}
+
+func newCam16ViewingConditions() cam16ViewingConditions {
+	whitePoint := [3]float64{95.047, 100, 108.883}
+	adaptingLuminance := 200 / math.Pi * yFromLstar(50) / 100
+	const surround = 2.0
+
+	vc := cam16ViewingConditions{}
+	rgbW := multiply(cam16FromXyz, whitePoint)
+	f := 0.8 + surround/10
+	vc.c = 0.59 + (0.69-0.59)*(f-0.9)*10
+	vc.nc = f
+	d := f * (1 - 1/3.6*math.Exp((-adaptingLuminance-42)/92))
+	d = math.Max(0, math.Min(1, d))
+	for i := range vc.rgbD {
+		vc.rgbD[i] = d*100/rgbW[i] + 1 - d
+	}
+
+	k := 1 / (5*adaptingLuminance + 1)
+	k4 := k * k * k * k
+	vc.fl = k4*adaptingLuminance + 0.1*(1-k4)*(1-k4)*math.Cbrt(5*adaptingLuminance)
+	vc.n = yFromLstar(50) / whitePoint[1]
+	vc.z = 1.48 + math.Sqrt(vc.n)
+	vc.nbb = 0.725 / math.Pow(vc.n, 0.2)
+	vc.ncb = vc.nbb
+
+	var rgbA [3]float64
+	for i := range rgbA {
+		factor := math.Pow(vc.fl*vc.rgbD[i]*rgbW[i]/100, 0.42)
+		rgbA[i] = 400 * factor / (factor + 27.13)
+	}
+	vc.aw = (2*rgbA[0] + rgbA[1] + 0.05*rgbA[2]) * vc.nbb
+	return vc
+}
+
+// cam16 returns the CAM16 lightness J, chroma and hue in degrees of c.
+func cam16(c colorful.Color) (j, chroma, hue float64) {
+	vc := defaultViewingConditions
+	x, y, z := c.Xyz()
+	cone := multiply(cam16FromXyz, [3]float64{x * 100, y * 100, z * 100})
+
+	var adapted [3]float64
+	for i := range cone {
+		d := vc.rgbD[i] * cone[i]
+		factor := math.Pow(vc.fl*math.Abs(d)/100, 0.42)
+		adapted[i] = math.Copysign(400*factor/(factor+27.13), d)
+	}
+
+	a := (11*adapted[0] - 12*adapted[1] + adapted[2]) / 11
+	b := (adapted[0] + adapted[1] - 2*adapted[2]) / 9
+	u := (20*adapted[0] + 20*adapted[1] + 21*adapted[2]) / 20
+	p2 := (40*adapted[0] + 20*adapted[1] + adapted[2]) / 20
+	hue = math.Mod(math.Atan2(b, a)*180/math.Pi+360, 360)
+
+	achromatic := p2 * vc.nbb
+	j = 100 * math.Pow(achromatic/vc.aw, vc.c*vc.z)
+
+	eHue := 0.25 * (math.Cos(hue*math.Pi/180+2) + 3.8)
+	p1 := 50000.0 / 13 * eHue * vc.nc * vc.ncb
+	t := p1 * math.Hypot(a, b) / (u + 0.305)
+	alpha := math.Pow(t, 0.9) * math.Pow(1.64-math.Pow(0.29, vc.n), 0.73)
+	chroma = alpha * math.Sqrt(j/100)
+	return j, chroma, hue
+}
+
+// fromCam16 converts CAM16 lightness, chroma and hue back to a color, which
+// may lie outside sRGB.
+func fromCam16(j, chroma, hue float64) colorful.Color {
+	vc := defaultViewingConditions
+	alpha := 0.0
+	if chroma != 0 && j != 0 {
+		alpha = chroma / math.Sqrt(j/100)
+	}
+	t := math.Pow(alpha/math.Pow(1.64-math.Pow(0.29, vc.n), 0.73), 1/0.9)
+	radians := hue * math.Pi / 180
+
+	eHue := 0.25 * (math.Cos(radians+2) + 3.8)
+	achromatic := vc.aw * math.Pow(j/100, 1/vc.c/vc.z)
+	p1 := eHue * 50000 / 13 * vc.nc * vc.ncb
+	p2 := achromatic / vc.nbb
+
+	sin, cos := math.Sin(radians), math.Cos(radians)
+	gamma := 23 * (p2 + 0.305) * t / (23*p1 + 11*t*cos + 108*t*sin)
+	a, b := gamma*cos, gamma*sin
+
+	adapted := [3]float64{
+		(460*p2 + 451*a + 288*b) / 1403,
+		(460*p2 - 891*a - 261*b) / 1403,
+		(460*p2 - 220*a - 6300*b) / 1403,
+	}
+	var cone [3]float64
+	for i, value := range adapted {
+		base := math.Max(0, 27.13*math.Abs(value)/(400-math.Abs(value)))
+		cone[i] = math.Copysign(100/vc.fl*math.Pow(base, 1/0.42), value) / vc.rgbD[i]
+	}
+
+	xyz := multiply(cam16ToXyz, cone)
+	return colorful.Xyz(xyz[0]/100, xyz[1]/100, xyz[2]/100)
+}
+
+// hct returns the hue, chroma and tone of c.
+func hct(c colorful.Color) (hue, chroma, tone float64) {
+	_, chroma, hue = cam16(c)
+	l, _, _ := c.Lab()
+	return hue, chroma, l * 100
+}
+
+// fromHct finds the color of the given hue and tone with the chroma closest
+// to the one asked for that sRGB can show.
+func fromHct(hue, chroma, tone float64) colorful.Color {
+	if tone <= 0 {
+		return colorful.Color{}
+	}
+	if tone >= 100 {
+		return colorful.Color{R: 1, G: 1, B: 1}
+	}
+
+	if c := hctWithTone(hue, chroma, tone); c.IsValid() {
+		return c
+	}
+	low, high := 0.0, chroma
+	for i := 0; i < 20; i++ {
+		middle := (low + high) / 2
+		if hctWithTone(hue, middle, tone).IsValid() {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return hctWithTone(hue, low, tone).Clamped()
+}
+
+// hctWithTone searches the CAM16 lightness giving tone at the given hue and
+// chroma.
+func hctWithTone(hue, chroma, tone float64) colorful.Color {
+	low, high := 0.0, 100.0
+	var c colorful.Color
+	for i := 0; i < 30; i++ {
+		j := (low + high) / 2
+		c = fromCam16(j, chroma, hue)
+		if l, _, _ := c.Lab(); l*100 < tone {
+			low = j
+		} else {
+			high = j
+		}
+	}
+	return c
+}
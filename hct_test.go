@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+func TestHct(t *testing.T) {
+	// Known answers of Material's color utilities.
+	for hex, want := range map[string][3]float64{
+		"#ff0000": {27.408, 113.357, 53.233},
+		"#00ff00": {142.139, 108.410, 87.737},
+		"#0000ff": {282.788, 87.230, 32.302},
+	} {
+		c, _ := colorful.Hex(hex)
+		hue, chroma, tone := hct(c)
+		if math.Abs(hue-want[0]) > 0.05 || math.Abs(chroma-want[1]) > 0.05 || math.Abs(tone-want[2]) > 0.05 {
+			t.Errorf("%s: got HCT %.3f %.3f %.3f, want %.3f %.3f %.3f", hex, hue, chroma, tone, want[0], want[1], want[2])
+		}
+		if got := fromHct(hue, chroma, tone).Hex(); got != hex {
+			t.Errorf("%s: came back as %s", hex, got)
+		}
+	}
+}
+
+func TestMaterialPalettes(t *testing.T) {
+	primary := materialPalettes(materialFallbackSeed)["primary"]
+	for tone, want := range map[int]string{
+		0:   "#000000",
+		10:  "#001a41",
+		40:  "#005ac1",
+		80:  "#adc6ff",
+		90:  "#d8e2ff",
+		100: "#ffffff",
+	} {
+		if got := primary.tone(tone).Hex(); got != want {
+			t.Errorf("primary-%d: got %s, want %s", tone, got, want)
+		}
+	}
+
+	// Tones out of gamut at the palette chroma keep their tone.
+	for _, name := range materialPaletteNames {
+		palette := materialPalettes(materialFallbackSeed)[name]
+		for _, tone := range materialTones {
+			if _, _, got := hct(palette.tone(tone)); math.Abs(got-float64(tone)) > 0.5 {
+				t.Errorf("%s-%d: got tone %.2f", name, tone, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+type imageEncoder func(io.Writer, image.Image) error
+
+// imageEncoders are keyed by lowercase file extension.
+var imageEncoders = map[string]imageEncoder{
+	".jpg":  encodeJPEG,
+	".jpeg": encodeJPEG,
+	".png":  encodePNG,
+}
+
+func encodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, nil)
+}
+
+func encodePNG(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
+}
+
+// imageEncoderFor picks the encoder matching the extension of fileName.
+func imageEncoderFor(fileName string) (imageEncoder, error) {
+	extension := strings.ToLower(filepath.Ext(fileName))
+	if encoder, ok := imageEncoders[extension]; ok {
+		return encoder, nil
+	}
+
+	return nil, fmt.Errorf("cannot tell the image format of %q, expected a .jpg, .jpeg or .png extension", fileName)
+}
+
+// outputFormat is the extension an output written to fileName is encoded
+// as, stdout gets a JPEG.
+func outputFormat(fileName string) string {
+	extension := strings.ToLower(filepath.Ext(fileName))
+	if fileName == "" || extension == ".jpeg" {
+		return ".jpg"
+	}
+	return extension
+}
@@ -4,65 +4,247 @@ import (
 	"image"
 	"image/color"
 	"math"
-	"sync"
+	"sync/atomic"
 
 	"github.com/lucasb-eyer/go-colorful"
 )
 
+const defaultTileSize = 256
+
 type ImageMapper struct {
-	Settings           Settings
-	LoadedImage        image.Image
-	MappedImage        *image.RGBA
-	MappedColorByColor *sync.Map
+	Settings    Settings
+	LoadedImage image.Image
+	MappedImage *image.RGBA
+	ColorCache  *ColorCache
+	MatchMap    *MatchMap
+	distance    colorMetric
+	// paletteUsage counts the pixels matched to each palette entry.
+	paletteUsage []atomic.Uint64
 }
 
 func NewImageMapper(settings Settings, loadedImage image.Image) (*ImageMapper, error) {
+	colorCache, err := NewColorCache(settings.ColorCacheSize, settings.ColorCacheEviction, settings.ColorCacheKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	distance, err := colorMetricByName(settings.Metric)
+	if err != nil {
+		return nil, err
+	}
+
 	mapper := &ImageMapper{
-		Settings:           settings,
-		MappedColorByColor: &sync.Map{},
-		LoadedImage:        loadedImage,
-		MappedImage:        image.NewRGBA(loadedImage.Bounds()),
+		Settings:     settings,
+		ColorCache:   colorCache,
+		LoadedImage:  loadedImage,
+		distance:     distance,
+		paletteUsage: make([]atomic.Uint64, len(settings.Palette)),
 	}
 
 	return mapper, nil
 }
 
-func (im *ImageMapper) QuantizePixelToPalette(x, y int) {
-	currentPixelColor := im.LoadedImage.At(x, y)
+// NearestPaletteIndex returns the index of the closest palette entry by
+// weighted distance, or -1 when the palette is empty.
+func (im *ImageMapper) NearestPaletteIndex(target colorful.Color) int {
+	minDistance := math.Inf(1)
+	nearest := -1
 
-	if mappedColor, ok := im.MappedColorByColor.Load(currentPixelColor); ok {
-		im.MappedImage.Set(x, y, mappedColor.(color.Color))
-		return
+	for i, entry := range im.Settings.Palette {
+		distance := im.distance(target, entry.Color) / entry.EffectiveWeight()
+		if distance < minDistance {
+			minDistance = distance
+			nearest = i
+		}
 	}
 
+	return nearest
+}
+
+// QuantizePixelToPalette maps one pixel into dst and returns its match.
+func (im *ImageMapper) QuantizePixelToPalette(dst *image.RGBA, cache *tileColorCache, x, y int) int {
+	currentPixelColor := im.LoadedImage.At(x, y)
 	targetLab, _ := colorful.MakeColor(currentPixelColor)
-	minDistance := math.Inf(1)
+
+	key := im.ColorCache.Key(currentPixelColor)
+	paletteIndex, ok := cache.Get(key)
+	if !ok {
+		paletteIndex = im.NearestPaletteIndex(im.ColorCache.KeyColor(key))
+		cache.Put(key, paletteIndex)
+	}
+
+	if im.MatchMap != nil {
+		im.MatchMap.Set(x, y, paletteIndex)
+	}
+
+	dst.Set(x, y, blendTowardPalette(im.Settings, targetLab, paletteIndex))
+	return paletteIndex
+}
+
+// blendTowardPalette moves a color toward the entry it matched by the entry
+// or palette affinity.
+func blendTowardPalette(settings Settings, source colorful.Color, paletteIndex int) colorful.Color {
 	var mappedColor colorful.Color
+	affinity := settings.PaletteAffinity
+	if paletteIndex >= 0 {
+		entry := settings.Palette[paletteIndex]
+		mappedColor = entry.Color
+		if entry.Affinity != nil {
+			affinity = *entry.Affinity
+		}
+	}
 
-	for _, c := range im.Settings.Palette {
-		distance := targetLab.DistanceLab(c.Color)
-		if distance < minDistance {
-			minDistance = distance
-			mappedColor = c.Color
+	return colorful.Color{
+		R: source.R + (mappedColor.R-source.R)*affinity,
+		G: source.G + (mappedColor.G-source.G)*affinity,
+		B: source.B + (mappedColor.B-source.B)*affinity,
+	}
+}
+
+func (im *ImageMapper) QuantizeTileToPalette(dst *image.RGBA, tile image.Rectangle) {
+	// Per tile counts keep shared counters and shard locks out of the loop.
+	usage := make([]uint64, len(im.paletteUsage))
+	cache := im.ColorCache.forTile()
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			if paletteIndex := im.QuantizePixelToPalette(dst, cache, x, y); paletteIndex >= 0 {
+				usage[paletteIndex]++
+			}
 		}
 	}
+	cache.Release()
 
-	adjustedColor := colorful.Color{
-		R: targetLab.R + (mappedColor.R-targetLab.R)*im.Settings.PaletteAffinity,
-		G: targetLab.G + (mappedColor.G-targetLab.G)*im.Settings.PaletteAffinity,
-		B: targetLab.B + (mappedColor.B-targetLab.B)*im.Settings.PaletteAffinity,
+	for i, count := range usage {
+		if count > 0 {
+			im.paletteUsage[i].Add(count)
+		}
 	}
+}
 
-	im.MappedImage.Set(x, y, adjustedColor)
-	im.MappedColorByColor.Store(currentPixelColor, adjustedColor)
+// PaletteUsage returns how many pixels matched each palette entry so far.
+func (im *ImageMapper) PaletteUsage() []uint64 {
+	usage := make([]uint64, len(im.paletteUsage))
+	for i := range im.paletteUsage {
+		usage[i] = im.paletteUsage[i].Load()
+	}
+	return usage
 }
 
-func (im *ImageMapper) QuantizeColorsToPalette(rowCh chan int) *ImageMapper {
-	for row := range rowCh {
-		for x := im.LoadedImage.Bounds().Min.X; x < im.LoadedImage.Bounds().Max.X; x++ {
-			im.QuantizePixelToPalette(x, row)
-		}
+func tileSize(settings Settings) int {
+	if settings.TileSize > 0 {
+		return settings.TileSize
+	}
+
+	return defaultTileSize
+}
+
+// QuantizeRectToPalette maps rect into dst in tiles on the pool, loading the
+// rows of a streamed source first.
+func (im *ImageMapper) QuantizeRectToPalette(pool *workerPool, dst *image.RGBA, rect image.Rectangle) {
+	if source, ok := im.LoadedImage.(*streamedPNG); ok {
+		source.load(rect.Min.Y, rect.Max.Y)
+	}
+	pool.RunTiles(rect, tileSize(im.Settings), func(tile image.Rectangle) {
+		im.QuantizeTileToPalette(dst, tile)
+	})
+}
+
+// RecordMatches keeps the entry every pixel matched, for re-rendering.
+func (im *ImageMapper) RecordMatches() error {
+	matchMap, err := NewMatchMap(im.Settings, im.LoadedImage)
+	if err != nil {
+		return err
 	}
 
+	im.MatchMap = matchMap
+	return nil
+}
+
+// QuantizeColorsToPalette maps the whole loaded image into MappedImage.
+func (im *ImageMapper) QuantizeColorsToPalette(pool *workerPool) *ImageMapper {
+	im.MappedImage = image.NewRGBA(im.LoadedImage.Bounds())
+	im.QuantizeRectToPalette(pool, im.MappedImage, im.LoadedImage.Bounds())
+
 	return im
 }
+
+// Output returns the mapped image, mapped lazily in bands under a memory
+// limit.
+func (im *ImageMapper) Output(pool *workerPool) image.Image {
+	bandHeight := im.BandHeight()
+	if bandHeight >= im.LoadedImage.Bounds().Dy() {
+		return im.QuantizeColorsToPalette(pool).MappedImage
+	}
+
+	return newBandedImage(im, pool, bandHeight)
+}
+
+// SourceErr returns the error a streamed source ran into during Output.
+func (im *ImageMapper) SourceErr() error {
+	if source, ok := im.LoadedImage.(*streamedPNG); ok {
+		return source.Err()
+	}
+	return nil
+}
+
+// BandHeight returns how many output rows fit in the memory limit next to
+// the source, in whole JPEG MCU rows.
+func (im *ImageMapper) BandHeight() int {
+	bounds := im.LoadedImage.Bounds()
+	if im.Settings.MemoryLimit == 0 || bounds.Empty() {
+		return bounds.Dy()
+	}
+
+	budget := int64(im.Settings.MemoryLimit)
+	bytesPerRow := int64(bounds.Dx()) * 4
+	if source, ok := im.LoadedImage.(*streamedPNG); ok {
+		budget -= source.decoderBytes()
+		bytesPerRow += source.windowBytesPerRow()
+	} else {
+		budget -= imageByteSize(im.LoadedImage)
+	}
+	rows := budget / bytesPerRow
+	rows -= rows % bandAlignment
+
+	if rows < bandAlignment {
+		return bandAlignment
+	}
+	if rows > int64(bounds.Dy()) {
+		return bounds.Dy()
+	}
+	return int(rows)
+}
+
+// decodedBytesPerPixel is the most a decoded pixel of the model takes.
+func decodedBytesPerPixel(model color.Model) int64 {
+	switch model {
+	case color.GrayModel, color.AlphaModel:
+		return 1
+	case color.Gray16Model, color.Alpha16Model:
+		return 2
+	case color.YCbCrModel:
+		return 3
+	case color.RGBAModel, color.NRGBAModel, color.CMYKModel, color.NYCbCrAModel:
+		return 4
+	}
+	if _, ok := model.(color.Palette); ok {
+		return 1
+	}
+	return 8
+}
+
+func imageByteSize(img image.Image) int64 {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return int64(len(img.Y) + len(img.Cb) + len(img.Cr))
+	case *image.RGBA:
+		return int64(len(img.Pix))
+	case *image.NRGBA:
+		return int64(len(img.Pix))
+	case *image.Gray:
+		return int64(len(img.Pix))
+	case *image.Paletted:
+		return int64(len(img.Pix) + len(img.Palette)*4)
+	}
+
+	return int64(img.Bounds().Dx()) * int64(img.Bounds().Dy()) * 8
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// inputExtensions are the image formats that can be decoded, keyed by
+// lowercase file extension.
+var inputExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+}
+
+// inputFile is an image to map, Path being empty for stdin. Rel is the path
+// its outputs mirror, Listed whether a directory or glob found it.
+type inputFile struct {
+	Path   string
+	Rel    string
+	Listed bool
+}
+
+// Stem is the file name of the input without its extension.
+func (f inputFile) Stem() string {
+	if f.Path == "" {
+		return "stdin"
+	}
+	base := filepath.Base(f.Path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// expandInputs turns files, globs and directories into images, leaving out
+// hidden files and anything under skipDir.
+func expandInputs(patterns []string, recursive bool, skipDir string) ([]inputFile, error) {
+	var inputs []inputFile
+	seen := map[string]bool{}
+
+	add := func(input inputFile) error {
+		absolutePath, err := filepath.Abs(input.Path)
+		if err != nil {
+			return err
+		}
+		if !seen[absolutePath] {
+			seen[absolutePath] = true
+			inputs = append(inputs, input)
+		}
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %q: %w", pattern, err)
+		}
+		isGlob := strings.ContainsAny(pattern, "*?[")
+		if len(matches) == 0 {
+			if isGlob {
+				return nil, fmt.Errorf("input pattern %q matches no files", pattern)
+			}
+			// Let os.Stat below explain what is wrong with the path.
+			matches = []string{pattern}
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+
+			if !info.IsDir() {
+				err = add(inputFile{Path: match, Rel: filepath.Base(match), Listed: isGlob})
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			files, err := listImages(match, recursive, skipDir)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				rel, err := filepath.Rel(match, file)
+				if err != nil {
+					return nil, err
+				}
+				if err := add(inputFile{Path: file, Rel: rel, Listed: true}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return inputs, nil
+}
+
+func listImages(dir string, recursive bool, skipDir string) ([]string, error) {
+	var files []string
+	absoluteSkipDir := ""
+	if skipDir != "" {
+		absoluteSkipDir, _ = filepath.Abs(skipDir)
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.IsDir() {
+			if path == dir {
+				return nil
+			}
+			if absolutePath, _ := filepath.Abs(path); !recursive || absolutePath == absoluteSkipDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if inputExtensions[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// mirroredOutputPath places the output of input under outputDir at the same
+// relative path, switching to PNG for formats that cannot be written.
+func mirroredOutputPath(input inputFile, outputDir string) string {
+	outputPath := filepath.Join(outputDir, input.Rel)
+	if _, err := imageEncoderFor(outputPath); err != nil {
+		outputPath = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".png"
+	}
+	return outputPath
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// isUpToDate tells whether every output is newer than its input and stamped
+// with a hash of the current effective settings.
+func isUpToDate(outputPaths, stamps []string, inputTime time.Time) bool {
+	for i, outputPath := range outputPaths {
+		info, err := os.Stat(outputPath)
+		if err != nil || info.ModTime().Before(inputTime) {
+			return false
+		}
+
+		stampPath, err := outputStampPath(outputPath)
+		if err != nil {
+			return false
+		}
+		stamp, err := os.ReadFile(stampPath)
+		if err != nil || string(stamp) != stamps[i] {
+			return false
+		}
+		// Stamps are pruned with the result cache, least recently used first.
+		now := time.Now()
+		_ = os.Chtimes(stampPath, now, now)
+	}
+
+	return len(outputPaths) > 0
+}
+
+// outputStampPath names the stamp of an output in the cache directory by a
+// hash of its absolute path.
+func outputStampPath(outputPath string) (string, error) {
+	dir, err := resultCacheDir()
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(outputPath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(dir, "stamps", hex.EncodeToString(sum[:])), nil
+}
+
+// writeOutputStamps records the settings outputs were mapped with. A stamp
+// that cannot be written only costs mapping the input again next time.
+func writeOutputStamps(outputPaths, stamps []string) {
+	for i, outputPath := range outputPaths {
+		stampPath, err := outputStampPath(outputPath)
+		if err != nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(stampPath), 0o755); err != nil {
+			continue
+		}
+		_ = writeFileAtomic(stampPath, []byte(stamps[i]))
+	}
+}
@@ -1,19 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"image"
 	_ "image/gif"
 	"image/jpeg"
 	_ "image/png"
+	"io"
 	"log"
 	"os"
-	"runtime"
-	"sync"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
 
 	"github.com/urfave/cli/v2"
 )
 
-func loadImageFromFile(inputFile *os.File) (image.Image, error) {
+const version = "0.1.0"
+
+func loadImageFromFile(inputFile io.Reader) (image.Image, error) {
 	img, _, err := image.Decode(inputFile)
 	if err != nil {
 		return nil, err
@@ -22,62 +30,422 @@ func loadImageFromFile(inputFile *os.File) (image.Image, error) {
 	return img, nil
 }
 
+// decodeInput decodes an image, streaming non-interlaced PNGs when a memory
+// limit is set and refusing other images that would exceed it.
+func decodeInput(input io.Reader, memoryLimit ByteSize, streamable bool) (image.Image, error) {
+	if memoryLimit == 0 {
+		return loadImageFromFile(input)
+	}
+
+	buffered := bufio.NewReader(input)
+	if header, _ := buffered.Peek(pngHeaderSize); streamable && pngStreamable(header) {
+		return newStreamedPNG(buffered)
+	}
+
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(buffered, &header))
+	if err != nil {
+		return nil, err
+	}
+	decodedSize := ByteSize(int64(config.Width) * int64(config.Height) * decodedBytesPerPixel(config.ColorModel))
+	if decodedSize > memoryLimit {
+		return nil, fmt.Errorf("decoding the %dx%d image takes about %s, more than the memory-limit of %s, "+
+			"only non-interlaced PNG images mapped once without --preview or --save-matches are decoded in bands",
+			config.Width, config.Height, decodedSize, memoryLimit)
+	}
+
+	return loadImageFromFile(io.MultiReader(&header, buffered))
+}
+
+// openInput opens input, or stdin, spooled to a temporary file with rewind
+// so that it can be read twice.
+func openInput(input inputFile, rewind bool) (*os.File, func(), error) {
+	if input.Path != "" {
+		file, err := os.Open(input.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, func() { file.Close() }, nil
+	}
+	if !rewind {
+		return os.Stdin, func() {}, nil
+	}
+
+	spool, err := os.CreateTemp("", "img2theme-stdin-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	if _, err := io.Copy(spool, os.Stdin); err != nil {
+		remove()
+		return nil, nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return spool, remove, nil
+}
+
+// hashInputFile digests an input opened by openInput and rewinds it.
+func hashInputFile(input *os.File) ([]byte, error) {
+	digest, err := hashInput(input)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := input.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return digest, nil
+}
+
 func mainAction(c *cli.Context) error {
-	settingsFilePath := c.Args().First()
+	settings, err := loadSettings(c)
+	if err != nil {
+		return err
+	}
+	if settings.MemoryLimit != 0 {
+		// Without a soft limit the heap grows to twice what bands keep live.
+		debug.SetMemoryLimit(int64(settings.MemoryLimit))
+	}
 
-	settings, err := loadSettingsFromYaml(settingsFilePath)
+	if c.IsSet("input") || c.IsSet("output") || len(settings.Mappings) > 0 {
+		return inputsAction(c, settings)
+	}
+
+	useResultCache := settings.ResultCache && !c.IsSet("save-matches")
+	input, closeInput, err := openInput(inputFile{}, useResultCache)
 	if err != nil {
 		return err
 	}
+	defer closeInput()
+
+	var resultCache *ResultCache
+	var resultCacheKey string
+	if useResultCache {
+		resultCache, err = NewResultCache(settings.ResultCacheMaxSize)
+		if err != nil {
+			return err
+		}
+		digest, err := hashInputFile(input)
+		if err != nil {
+			return err
+		}
+		resultCacheKey, err = ResultCacheKey(digest, settings, mappingOptions(c, resolvedMapping{Settings: settings})...)
+		if err != nil {
+			return err
+		}
+
+		if output, ok := resultCache.Open(resultCacheKey, outputFormat("")); ok {
+			defer output.Close()
+			_, err = io.Copy(os.Stdout, output)
+			if err != nil {
+				return err
+			}
+
+			log.Println("Cached image written to stdout")
+			return nil
+		}
+	}
 
-	loadedImage, err := loadImageFromFile(os.Stdin)
+	streamable := !c.IsSet("preview") && !c.IsSet("save-matches")
+	loadedImage, err := decodeInput(input, settings.MemoryLimit, streamable)
 	if err != nil {
 		return err
 	}
 
-	mapper, err := NewImageMapper(settings, loadedImage)
+	var mapper *ImageMapper
+	if c.IsSet("preview") {
+		previewSize, err := parseDimensions(c.String("preview"))
+		if err != nil {
+			return err
+		}
+		mapper, err = NewPreviewMapper(settings, loadedImage, previewSize, c.String("preview-filter"))
+		if err != nil {
+			return err
+		}
+	} else {
+		mapper, err = NewImageMapper(settings, loadedImage)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.IsSet("save-matches") {
+		err = mapper.RecordMatches()
+		if err != nil {
+			return err
+		}
+	}
+
+	pool := newWorkerPool(availableCPUs(settings.Cpus))
+	defer pool.Close()
+
+	err = writeMappingOutput("", resultCache, resultCacheKey, func(w io.Writer) error {
+		if err := jpeg.Encode(w, mapper.Output(pool), nil); err != nil {
+			return err
+		}
+		return mapper.SourceErr()
+	})
 	if err != nil {
 		return err
 	}
 
-	numCPU := settings.Cpus
-	if numCPU == 0 {
-		numCPU = runtime.NumCPU()
+	log.Println("Image mapped and written to stdout")
+
+	if c.IsSet("save-matches") {
+		err = saveMatchMap(mapper.MatchMap, c.String("save-matches"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("verbose") {
+		logMapperStats(mapper)
+	}
+
+	return nil
+}
+
+// inputsAction maps every input with every mapping and writes the outputs to
+// files, mirroring directory inputs under --output.
+func inputsAction(c *cli.Context, settings Settings) error {
+	if c.IsSet("save-matches") {
+		return errors.New("--save-matches can only be used when mapping stdin to stdout with a single mapping")
 	}
 
-	var wg sync.WaitGroup
-	rowCh := make(chan int, numCPU)
+	outputPath := c.String("output")
+	inputs := []inputFile{{}}
+	if c.IsSet("input") {
+		var err error
+		inputs, err = expandInputs(c.StringSlice("input"), c.Bool("recursive"), outputPath)
+		if err != nil {
+			return err
+		}
+		if len(inputs) == 0 {
+			return fmt.Errorf("no images found in %s", strings.Join(c.StringSlice("input"), ", "))
+		}
+	}
 
-	for i := 0; i < numCPU; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			mapper.QuantizeColorsToPalette(rowCh)
-		}()
+	namedOutputs := len(settings.Mappings) > 0 && settings.Mappings[0].OutputFileName != ""
+	outputIsDir := len(inputs) > 1 || inputs[0].Listed ||
+		strings.HasSuffix(outputPath, string(filepath.Separator)) || isDirectory(outputPath)
+	if !namedOutputs && outputIsDir && outputPath == "" {
+		return errors.New("--output DIR is required when mapping several inputs, a directory or a glob")
+	}
+	if !namedOutputs && outputIsDir && inputs[0].Path == "" {
+		return fmt.Errorf("the output of stdin needs a file name, %s is a directory", outputPath)
 	}
 
-	for y := mapper.LoadedImage.Bounds().Min.Y; y < mapper.LoadedImage.Bounds().Max.Y; y++ {
-		rowCh <- y
+	var resultCache *ResultCache
+	if settings.ResultCache {
+		var err error
+		resultCache, err = NewResultCache(settings.ResultCacheMaxSize)
+		if err != nil {
+			return err
+		}
 	}
-	close(rowCh)
-	wg.Wait()
 
-	jpeg.Encode(os.Stdout, mapper.MappedImage, nil)
+	pool := newWorkerPool(availableCPUs(settings.Cpus))
+	defer pool.Close()
 
-	log.Println("Image mapped and written to stdout")
+	writtenBy := map[string]string{}
+	failed := 0
+	for _, input := range inputs {
+		inputName := input.Path
+		if inputName == "" {
+			inputName = "stdin"
+		}
+
+		mappings, err := resolveMappings(settings, input.Stem())
+		if err != nil {
+			return err
+		}
+
+		var outputPaths []string
+		for i := range mappings {
+			switch {
+			case mappings[i].OutputFileName != "":
+				mappings[i].OutputFileName = filepath.Join(outputPath, filepath.Dir(input.Rel), mappings[i].OutputFileName)
+			case outputIsDir:
+				mappings[i].OutputFileName = mirroredOutputPath(input, outputPath)
+			default:
+				mappings[i].OutputFileName = outputPath
+			}
+
+			if fileName := mappings[i].OutputFileName; fileName != "" {
+				if other, ok := writtenBy[fileName]; ok {
+					return fmt.Errorf("%s and %s would both be written to %s", other, inputName, fileName)
+				}
+				writtenBy[fileName] = inputName
+				outputPaths = append(outputPaths, fileName)
+			}
+		}
+
+		var stamps []string
+		if input.Path != "" && len(outputPaths) == len(mappings) {
+			for _, mapping := range mappings {
+				stamp, err := ResultCacheKey(nil, mapping.Settings, mappingOptions(c, mapping)...)
+				if err != nil {
+					return err
+				}
+				stamps = append(stamps, stamp)
+			}
+		}
+
+		if stamps != nil && !c.Bool("force") {
+			info, err := os.Stat(input.Path)
+			if err != nil {
+				return err
+			}
+			if isUpToDate(outputPaths, stamps, info.ModTime()) {
+				log.Printf("Skipping %s, its outputs are up to date\n", input.Path)
+				continue
+			}
+		}
 
+		err = mapInput(c, input, mappings, pool, resultCache)
+		if err == nil && stamps != nil {
+			writeOutputStamps(outputPaths, stamps)
+		}
+		if err != nil {
+			if len(inputs) == 1 {
+				return err
+			}
+			log.Printf("%s: %v\n", inputName, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d inputs failed", failed, len(inputs))
+	}
 	return nil
 }
 
-func main() {
-	app := &cli.App{
-		Name:      "img2theme",
-		Usage:     "Map colors in an image to a specified palette.\nExample usage: img2theme settings.yaml <input.jpg >output.jpg",
-		ArgsUsage: "<settings.yaml>",
-		Action:    mainAction,
+// mappingOptions are the flags besides the settings that change an output.
+func mappingOptions(c *cli.Context, mapping resolvedMapping) []string {
+	return []string{
+		"preview=" + c.String("preview"), "preview-filter=" + c.String("preview-filter"),
+		"format=" + outputFormat(mapping.OutputFileName),
+	}
+}
+
+func mapInput(c *cli.Context, input inputFile, mappings []resolvedMapping, pool *workerPool, resultCache *ResultCache) error {
+	file, closeInput, err := openInput(input, resultCache != nil)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	var cacheKeys []string
+	if resultCache != nil {
+		digest, err := hashInputFile(file)
+		if err != nil {
+			return err
+		}
+		for _, mapping := range mappings {
+			key, err := ResultCacheKey(digest, mapping.Settings, mappingOptions(c, mapping)...)
+			if err != nil {
+				return err
+			}
+			cacheKeys = append(cacheKeys, key)
+		}
+	}
+
+	load := func() (image.Image, error) {
+		streamable := len(mappings) == 1 && !c.IsSet("preview")
+		loadedImage, err := decodeInput(file, mappings[0].Settings.MemoryLimit, streamable)
+		if err != nil || !c.IsSet("preview") {
+			return loadedImage, err
+		}
+
+		previewSize, err := parseDimensions(c.String("preview"))
+		if err != nil {
+			return nil, err
+		}
+		return previewImage(loadedImage, previewSize, c.String("preview-filter"))
+	}
+
+	return runMappings(mappings, load, pool, resultCache, cacheKeys, c.Bool("verbose"))
+}
+
+func newApp() *cli.App {
+	return &cli.App{
+		Name:    "img2theme",
+		Version: version,
+		// --set values are YAML and may contain commas, e.g. palette lists.
+		DisableSliceFlagSeparator: true,
+		Usage:                     "Map colors in an image to a specified palette.\nExample usage: img2theme settings.yaml <input.jpg >output.jpg",
+		ArgsUsage:                 "[settings.yaml...]",
+		Action:                    mainAction,
+		Flags: append(settingsFlags(),
+			&cli.BoolFlag{
+				Name:  "verbose",
+				Usage: "log color cache statistics after mapping",
+			},
+			&cli.StringFlag{
+				Name:  "preview",
+				Usage: "downscale the image to fit within `WIDTHxHEIGHT` before mapping, for quickly tuning settings",
+				Action: func(c *cli.Context, preview string) error {
+					_, err := parseDimensions(preview)
+					return err
+				},
+			},
+			&cli.StringFlag{
+				Name:  "preview-filter",
+				Usage: "filter used to downscale previews: box or lanczos",
+				Value: defaultPreviewFilter,
+				Action: func(c *cli.Context, filter string) error {
+					_, err := resampleFilterByName(filter)
+					return err
+				},
+			},
+			&cli.StringSliceFlag{
+				Name:    "input",
+				Aliases: []string{"i"},
+				Usage:   "map image `FILE`s, quoted globs or directories instead of stdin, may be repeated",
+			},
+			&cli.BoolFlag{
+				Name:    "recursive",
+				Aliases: []string{"r"},
+				Usage:   "look for images in subdirectories of --input directories too",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "write to `PATH` instead of stdout, a directory mirroring the inputs when there are several",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "map inputs even when their outputs are newer than them and were mapped with the same settings",
+			},
+			&cli.StringFlag{
+				Name:  "save-matches",
+				Usage: "write the palette entry matched by every pixel to `FILE`, for re-rendering with the render command",
+			},
+		),
+		Commands: []*cli.Command{
+			renderCommand,
+			cacheCommand,
+			benchCommand,
+			validateCommand,
+			schemaCommand,
+			profilesCommand,
+			palettesCommand,
+			paletteCommand,
+			extractCommand,
+			base16Command,
+			materialCommand,
+		},
 	}
+}
 
-	err := app.Run(os.Args)
+func main() {
+	err := newApp().Run(os.Args)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// applyFlags builds the flag set of a command the way urfave/cli does when it
+// runs, which panics on flags defined twice.
+func applyFlags(t *testing.T, name string, flags []cli.Flag) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s: %v", name, r)
+		}
+	}()
+
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	for _, f := range flags {
+		if err := f.Apply(set); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	app := newApp()
+	applyFlags(t, app.Name, app.Flags)
+
+	var visit func(path []string, commands []*cli.Command)
+	visit = func(path []string, commands []*cli.Command) {
+		for _, command := range commands {
+			commandPath := append(append([]string{}, path...), command.Name)
+			applyFlags(t, strings.Join(commandPath, " "), command.Flags)
+			visit(commandPath, command.Subcommands)
+		}
+	}
+	visit([]string{app.Name}, app.Commands)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// resolvedMapping is a mapping with the top level settings filled in.
+// OutputFileName is empty when the output goes to stdout.
+type resolvedMapping struct {
+	Settings       Settings
+	OutputFileName string
+}
+
+// mappingTemplateData is what output file name templates can refer to, as
+// fields like {{.PaletteAffinity}} or functions like {{paletteAffinity}}.
+type mappingTemplateData struct {
+	Index           int
+	Name            string
+	Input           string
+	PaletteAffinity float64
+	Palette         []string
+}
+
+func (m Mapping) settings(base Settings) Settings {
+	base.Mappings = nil
+	if len(m.Palette) > 0 {
+		base.Palette = m.Palette
+	}
+	if m.PaletteAffinity != nil {
+		base.PaletteAffinity = *m.PaletteAffinity
+	}
+
+	return base
+}
+
+// outputFileName renders the output file name template for the input with
+// the given stem.
+func (m Mapping) outputFileName(index int, base Settings, input string) (string, error) {
+	settings := m.settings(base)
+	data := mappingTemplateData{
+		Index:           index,
+		Name:            m.Name,
+		Input:           input,
+		PaletteAffinity: settings.PaletteAffinity,
+		Palette:         make([]string, len(settings.Palette)),
+	}
+	for i, entry := range settings.Palette {
+		data.Palette[i] = entry.Label()
+	}
+
+	funcs := template.FuncMap{
+		"name":            func() string { return data.Name },
+		"input":           func() string { return data.Input },
+		"paletteAffinity": func() float64 { return data.PaletteAffinity },
+	}
+	tmpl, err := template.New("output-file-name").Option("missingkey=error").Funcs(funcs).Parse(m.OutputFileName)
+	if err != nil {
+		return "", err
+	}
+
+	var fileName strings.Builder
+	if err := tmpl.Execute(&fileName, data); err != nil {
+		return "", err
+	}
+	return fileName.String(), nil
+}
+
+// resolveMappings returns the outputs settings describe for an input: every
+// mapping, or the top level settings alone when there are none.
+func resolveMappings(settings Settings, input string) ([]resolvedMapping, error) {
+	if len(settings.Mappings) == 0 {
+		return []resolvedMapping{{Settings: settings}}, nil
+	}
+
+	mappings := make([]resolvedMapping, len(settings.Mappings))
+	for i, mapping := range settings.Mappings {
+		mappings[i].Settings = mapping.settings(settings)
+		if mapping.OutputFileName == "" {
+			continue
+		}
+
+		fileName, err := mapping.outputFileName(i, settings, input)
+		if err != nil {
+			return nil, fmt.Errorf("mappings[%d].output-file-name: %w", i, err)
+		}
+		mappings[i].OutputFileName = fileName
+	}
+
+	return mappings, nil
+}
+
+// validateMappings checks what struct tags cannot express: that every mapping
+// ends up with a palette and a file of its own to write.
+func validateMappings(settings Settings) []SettingsProblem {
+	var problems []SettingsProblem
+	writtenBy := map[string]int{}
+
+	for i, mapping := range settings.Mappings {
+		path := fmt.Sprintf("mappings[%d]", i)
+		add := func(field, format string, args ...interface{}) {
+			problems = append(problems, SettingsProblem{Path: path + "." + field, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if len(mapping.Palette) == 0 && len(settings.Palette) == 0 {
+			add("palette", "must not be empty, there is no top level palette to fall back to")
+		}
+
+		if mapping.OutputFileName == "" {
+			if len(settings.Mappings) > 1 {
+				add("output-file-name", "is required when there are several mappings")
+			}
+			continue
+		}
+
+		fileName, err := mapping.outputFileName(i, settings, "input")
+		if err != nil {
+			add("output-file-name", "%v", err)
+			continue
+		}
+		if _, err := imageEncoderFor(fileName); err != nil {
+			add("output-file-name", "%v", err)
+		}
+		if other, ok := writtenBy[fileName]; ok {
+			add("output-file-name", "writes to %q like mappings[%d]", fileName, other)
+		}
+		writtenBy[fileName] = i
+	}
+
+	return problems
+}
+
+// runMappings writes the output of every mapping, loading the image only when
+// some output is not cached. Mappings matching alike share one search.
+func runMappings(mappings []resolvedMapping, load func() (image.Image, error), pool *workerPool, resultCache *ResultCache, cacheKeys []string, verbose bool) error {
+	var groups [][]int
+	for i, mapping := range mappings {
+		if resultCache != nil {
+			if output, ok := resultCache.Open(cacheKeys[i], outputFormat(mapping.OutputFileName)); ok {
+				err := writeMappingOutput(mapping.OutputFileName, nil, "", func(w io.Writer) error {
+					_, err := io.Copy(w, output)
+					return err
+				})
+				output.Close()
+				if err != nil {
+					return err
+				}
+				log.Printf("Cached image written to %s\n", outputName(mapping.OutputFileName))
+				continue
+			}
+		}
+
+		matching := matchingSettingsOf(mapping.Settings)
+		grouped := false
+		for g, group := range groups {
+			if reflect.DeepEqual(matchingSettingsOf(mappings[group[0]].Settings), matching) {
+				groups[g] = append(group, i)
+				grouped = true
+				break
+			}
+		}
+		if !grouped {
+			groups = append(groups, []int{i})
+		}
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+	img, err := load()
+	if err != nil {
+		return err
+	}
+
+	write := func(i int, mapper *ImageMapper, mapped image.Image) error {
+		encode := encodeJPEG
+		if mappings[i].OutputFileName != "" {
+			var err error
+			encode, err = imageEncoderFor(mappings[i].OutputFileName)
+			if err != nil {
+				return err
+			}
+		}
+
+		var cacheKey string
+		if resultCache != nil {
+			cacheKey = cacheKeys[i]
+		}
+		err := writeMappingOutput(mappings[i].OutputFileName, resultCache, cacheKey, func(w io.Writer) error {
+			if err := encode(w, mapped); err != nil {
+				return err
+			}
+			return mapper.SourceErr()
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Image mapped and written to %s\n", outputName(mappings[i].OutputFileName))
+		return nil
+	}
+
+	for _, group := range groups {
+		mapper, err := NewImageMapper(mappings[group[0]].Settings, img)
+		if err != nil {
+			return err
+		}
+
+		if len(group) == 1 {
+			err = write(group[0], mapper, mapper.Output(pool))
+		} else {
+			err = mapper.RecordMatches()
+			if err != nil {
+				return err
+			}
+			err = write(group[0], mapper, mapper.QuantizeColorsToPalette(pool).MappedImage)
+			for _, i := range group[1:] {
+				if err != nil {
+					break
+				}
+
+				var rendered *image.RGBA
+				rendered, err = mapper.MatchMap.Render(pool, mappings[i].Settings)
+				if err == nil {
+					err = write(i, mapper, rendered)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if verbose {
+			logMapperStats(mapper)
+		}
+	}
+
+	return nil
+}
+
+// writeMappingOutput writes an output to its file, or stdout, and to the
+// result cache, keeping neither when write fails.
+func writeMappingOutput(fileName string, resultCache *ResultCache, cacheKey string, write func(io.Writer) error) error {
+	var output io.Writer = os.Stdout
+	var file *atomicFile
+	if fileName != "" {
+		if err := os.MkdirAll(filepath.Dir(fileName), 0o755); err != nil {
+			return err
+		}
+		var err error
+		file, err = createFileAtomic(fileName)
+		if err != nil {
+			return err
+		}
+		defer file.Abort()
+		output = file
+	}
+
+	var entry *atomicFile
+	if resultCache != nil {
+		var err error
+		entry, err = resultCache.Create(cacheKey, outputFormat(fileName))
+		if err != nil {
+			return err
+		}
+		defer entry.Abort()
+		output = io.MultiWriter(output, entry)
+	}
+
+	if err := write(output); err != nil {
+		return err
+	}
+	if file != nil {
+		if err := file.Commit(); err != nil {
+			return err
+		}
+	}
+	if entry != nil {
+		return resultCache.Commit(entry)
+	}
+	return nil
+}
+
+func outputName(fileName string) string {
+	if fileName == "" {
+		return "stdout"
+	}
+	return fileName
+}
+
+// logMapperStats reports how well the color cache of mapper did and how many
+// pixels matched each palette entry.
+func logMapperStats(mapper *ImageMapper) {
+	stats := mapper.ColorCache.Stats()
+	log.Printf("Color cache: %d hits, %d misses (%.1f%% hit rate), %d evictions, %d entries\n",
+		stats.Hits, stats.Misses, stats.HitRate()*100, stats.Evictions, stats.Entries)
+
+	usage := mapper.PaletteUsage()
+	var total uint64
+	for _, count := range usage {
+		total += count
+	}
+	for i, entry := range mapper.Settings.Palette {
+		share := 0.0
+		if total > 0 {
+			share = float64(usage[i]) / float64(total) * 100
+		}
+		log.Printf("Palette %s: %d pixels (%.1f%%)\n", entry.Label(), usage[i], share)
+	}
+}
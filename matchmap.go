@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"reflect"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	matchMapFormatVersion = 3
+	noPaletteMatch        = math.MaxUint16
+)
+
+// MatchMap holds the palette entry every pixel matched, so settings that only
+// change blending can skip the nearest color search.
+type MatchMap struct {
+	Matching MatchingSettings
+	Source   image.Image
+	Indices  []uint16
+}
+
+// MatchingSettings are the parts of Settings that decide which entry a pixel
+// matches.
+type MatchingSettings struct {
+	PaletteColors     []colorful.Color
+	PaletteWeights    []float64
+	ColorCacheKeyBits int
+	Metric            string
+}
+
+func matchingSettingsOf(settings Settings) MatchingSettings {
+	matching := MatchingSettings{
+		PaletteColors:     make([]colorful.Color, len(settings.Palette)),
+		PaletteWeights:    make([]float64, len(settings.Palette)),
+		ColorCacheKeyBits: settings.ColorCacheKeyBits,
+		Metric:            settings.Metric,
+	}
+	if matching.ColorCacheKeyBits == 0 {
+		matching.ColorCacheKeyBits = defaultColorCacheKeyBits
+	}
+	if matching.Metric == "" {
+		matching.Metric = defaultColorMetric
+	}
+	for i, entry := range settings.Palette {
+		matching.PaletteColors[i] = entry.Color
+		matching.PaletteWeights[i] = entry.EffectiveWeight()
+	}
+
+	return matching
+}
+
+func NewMatchMap(settings Settings, source image.Image) (*MatchMap, error) {
+	if len(settings.Palette) >= noPaletteMatch {
+		return nil, fmt.Errorf("cannot record matches for palettes with %d or more colors", noPaletteMatch)
+	}
+
+	bounds := source.Bounds()
+	return &MatchMap{
+		Matching: matchingSettingsOf(settings),
+		Source:   source,
+		Indices:  make([]uint16, bounds.Dx()*bounds.Dy()),
+	}, nil
+}
+
+func (mm *MatchMap) offset(x, y int) int {
+	bounds := mm.Source.Bounds()
+	return (y-bounds.Min.Y)*bounds.Dx() + (x - bounds.Min.X)
+}
+
+func (mm *MatchMap) Set(x, y, paletteIndex int) {
+	if paletteIndex < 0 {
+		paletteIndex = noPaletteMatch
+	}
+	mm.Indices[mm.offset(x, y)] = uint16(paletteIndex)
+}
+
+func (mm *MatchMap) At(x, y int) int {
+	paletteIndex := mm.Indices[mm.offset(x, y)]
+	if paletteIndex == noPaletteMatch {
+		return -1
+	}
+	return int(paletteIndex)
+}
+
+// CheckCompatible reports why settings would match pixels differently than
+// the ones the map was recorded with, if they would.
+func (mm *MatchMap) CheckCompatible(settings Settings) error {
+	matching := matchingSettingsOf(settings)
+
+	if matching.ColorCacheKeyBits != mm.Matching.ColorCacheKeyBits {
+		return fmt.Errorf("matches were recorded with color-cache-key-bits %d, settings use %d",
+			mm.Matching.ColorCacheKeyBits, matching.ColorCacheKeyBits)
+	}
+	if matching.Metric != mm.Matching.Metric {
+		return fmt.Errorf("matches were recorded with metric %s, settings use %s", mm.Matching.Metric, matching.Metric)
+	}
+	if !reflect.DeepEqual(matching.PaletteColors, mm.Matching.PaletteColors) {
+		return errors.New("matches were recorded with a different palette")
+	}
+	if !reflect.DeepEqual(matching.PaletteWeights, mm.Matching.PaletteWeights) {
+		return errors.New("matches were recorded with different palette weights")
+	}
+
+	return nil
+}
+
+// Render blends the source image toward the recorded palette matches using
+// the blend settings of settings.
+func (mm *MatchMap) Render(pool *workerPool, settings Settings) (*image.RGBA, error) {
+	if err := mm.CheckCompatible(settings); err != nil {
+		return nil, err
+	}
+
+	rendered := image.NewRGBA(mm.Source.Bounds())
+	pool.RunTiles(mm.Source.Bounds(), tileSize(settings), func(tile image.Rectangle) {
+		for y := tile.Min.Y; y < tile.Max.Y; y++ {
+			for x := tile.Min.X; x < tile.Max.X; x++ {
+				source, _ := colorful.MakeColor(mm.Source.At(x, y))
+				rendered.Set(x, y, blendTowardPalette(settings, source, mm.At(x, y)))
+			}
+		}
+	})
+
+	return rendered, nil
+}
+
+type matchMapFile struct {
+	Version   int
+	Matching  MatchingSettings
+	SourcePNG []byte
+	Indices   []uint16
+}
+
+// WriteTo stores the map with a lossless copy of its source image as a
+// gzipped gob stream.
+func (mm *MatchMap) WriteTo(w io.Writer) (int64, error) {
+	var sourcePNG bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&sourcePNG, mm.Source); err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: w}
+	compressor, err := gzip.NewWriterLevel(counter, gzip.BestSpeed)
+	if err != nil {
+		return 0, err
+	}
+	err = gob.NewEncoder(compressor).Encode(matchMapFile{
+		Version:   matchMapFormatVersion,
+		Matching:  mm.Matching,
+		SourcePNG: sourcePNG.Bytes(),
+		Indices:   mm.Indices,
+	})
+	if err != nil {
+		return counter.n, err
+	}
+
+	err = compressor.Close()
+	return counter.n, err
+}
+
+func ReadMatchMap(r io.Reader) (*MatchMap, error) {
+	decompressor, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+
+	var file matchMapFile
+	if err := gob.NewDecoder(decompressor).Decode(&file); err != nil {
+		return nil, err
+	}
+	if file.Version != matchMapFormatVersion {
+		return nil, fmt.Errorf("unsupported match map version %d", file.Version)
+	}
+
+	source, err := png.Decode(bytes.NewReader(file.SourcePNG))
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Indices) != source.Bounds().Dx()*source.Bounds().Dy() {
+		return nil, errors.New("match map does not cover its source image")
+	}
+
+	return &MatchMap{
+		Matching: file.Matching,
+		Source:   source,
+		Indices:  file.Indices,
+	}, nil
+}
+
+func saveMatchMap(matchMap *MatchMap, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := matchMap.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func loadMatchMap(filePath string) (*MatchMap, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadMatchMap(file)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
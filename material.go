@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	// materialCandidates is how many colors a wallpaper is quantized to before
+	// scoring.
+	materialCandidates = 128
+	// materialMinimumChroma, materialMinimumTone and materialMinimumProportion
+	// drop grays, near blacks and colors of hues that hardly appear in the
+	// image.
+	materialMinimumChroma     = 15
+	materialMinimumTone       = 10
+	materialMinimumProportion = 0.01
+	// materialTargetChroma is the chroma scoring favors.
+	materialTargetChroma = 48
+)
+
+// materialFallbackSeed is the seed of images without a usable color, Google
+// blue.
+var materialFallbackSeed = colorful.Color{R: 0x42 / 255.0, G: 0x85 / 255.0, B: 0xf4 / 255.0}
+
+// materialTones are the tones tonal palettes are given at.
+var materialTones = []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 99, 100}
+
+// materialPaletteNames are the tonal palettes in the order they are written.
+var materialPaletteNames = []string{"primary", "secondary", "tertiary", "neutral", "neutral-variant"}
+
+// tonalPalette holds one hue and chroma, giving a color at any tone.
+type tonalPalette struct {
+	Hue, Chroma float64
+}
+
+func (p tonalPalette) tone(tone int) colorful.Color {
+	return fromHct(p.Hue, p.Chroma, float64(tone))
+}
+
+// scoreMaterialSeeds ranks candidates as Material does, by how much of the
+// image their hue covers and by chroma. The result may be empty.
+func scoreMaterialSeeds(candidates []extractedColor) []colorful.Color {
+	var hueProportions [360]float64
+	total := 0.0
+	for _, candidate := range candidates {
+		total += candidate.Coverage
+	}
+	if total == 0 {
+		return nil
+	}
+	for _, candidate := range candidates {
+		hue, _, _ := hct(candidate.Color)
+		hueProportions[int(math.Floor(hue))%360] += candidate.Coverage / total
+	}
+
+	type scored struct {
+		color colorful.Color
+		score float64
+	}
+	var scores []scored
+	for _, candidate := range candidates {
+		hue, chroma, tone := hct(candidate.Color)
+		excited := 0.0
+		for offset := -15; offset <= 15; offset++ {
+			excited += hueProportions[(int(math.Floor(hue))+offset+360)%360]
+		}
+		if chroma < materialMinimumChroma || tone < materialMinimumTone || excited <= materialMinimumProportion {
+			continue
+		}
+
+		chromaWeight := 0.3
+		if chroma < materialTargetChroma {
+			chromaWeight = 0.1
+		}
+		score := excited*100*0.7 + (chroma-materialTargetChroma)*chromaWeight
+		scores = append(scores, scored{candidate.Color, score})
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+
+	// Seeds of about the same hue as a better one add nothing.
+	var seeds []colorful.Color
+	for _, s := range scores {
+		hue, _, _ := hct(s.color)
+		duplicate := false
+		for _, seed := range seeds {
+			if seedHue, _, _ := hct(seed); hueDistance(hue, seedHue) < 15 {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			seeds = append(seeds, s.color)
+		}
+	}
+	return seeds
+}
+
+// materialPalettes derives the tonal palettes of a Material You theme from
+// its seed color.
+func materialPalettes(seed colorful.Color) map[string]tonalPalette {
+	hue, chroma, _ := hct(seed)
+	return map[string]tonalPalette{
+		"primary":         {hue, math.Max(chroma, 48)},
+		"secondary":       {hue, 16},
+		"tertiary":        {math.Mod(hue+60, 360), 24},
+		"neutral":         {hue, 4},
+		"neutral-variant": {hue, 8},
+	}
+}
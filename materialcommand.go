@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/urfave/cli/v2"
+)
+
+var materialCommand = &cli.Command{
+	Name:  "material",
+	Usage: "Pick a seed color from a wallpaper and generate Material You tonal palettes from it, in HCT (CAM16 hue and chroma, L* tone).\nExample usage: img2theme material --format json <wallpaper.jpg >colors.json",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "palette for settings YAML with entries named like primary-40, json for templates",
+			Value: "palette",
+		},
+		&cli.StringFlag{
+			Name:  "seed-color",
+			Usage: "use `COLOR` as the seed instead of scoring an image",
+		},
+		&cli.StringFlag{
+			Name:    "input",
+			Aliases: []string{"i"},
+			Usage:   "read the image from `FILE` instead of stdin",
+		},
+	},
+	Action: materialAction,
+}
+
+// materialTheme is the JSON written for templates: every palette maps tones
+// to hex colors.
+type materialTheme struct {
+	Seed     string                       `json:"seed"`
+	Palettes map[string]map[string]string `json:"palettes"`
+}
+
+func materialAction(c *cli.Context) error {
+	format := c.String("format")
+	if format != "palette" && format != "json" {
+		return fmt.Errorf("unknown format %q, expected palette or json", format)
+	}
+
+	var seed colorful.Color
+	if c.String("seed-color") != "" {
+		var err error
+		if seed, err = parseColorString(c.String("seed-color")); err != nil {
+			return fmt.Errorf("--seed-color %q: %w", c.String("seed-color"), err)
+		}
+	} else {
+		var err error
+		if seed, err = materialSeedFromImage(c.String("input")); err != nil {
+			return err
+		}
+	}
+
+	palettes := materialPalettes(seed)
+	output := bufio.NewWriter(os.Stdout)
+	if format == "json" {
+		theme := materialTheme{Seed: seed.Hex(), Palettes: map[string]map[string]string{}}
+		for _, name := range materialPaletteNames {
+			tones := map[string]string{}
+			for _, tone := range materialTones {
+				tones[strconv.Itoa(tone)] = palettes[name].tone(tone).Hex()
+			}
+			theme.Palettes[name] = tones
+		}
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(theme); err != nil {
+			return err
+		}
+		return output.Flush()
+	}
+
+	hue, chroma, tone := hct(seed)
+	fmt.Fprintf(output, "# Material tonal palettes of seed %s, hue %.0f, chroma %.0f, tone %.0f\n", seed.Hex(), hue, chroma, tone)
+	fmt.Fprintln(output, "palette:")
+	for _, name := range materialPaletteNames {
+		for _, tone := range materialTones {
+			fmt.Fprintf(output, "  - {name: %s-%d, color: '%s'}\n", name, tone, palettes[name].tone(tone).Hex())
+		}
+	}
+	return output.Flush()
+}
+
+// materialSeedFromImage scores the colors of the image at path, stdin when
+// empty, and returns the best seed.
+func materialSeedFromImage(path string) (colorful.Color, error) {
+	var input io.Reader = os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return colorful.Color{}, err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	img, err := loadImageFromFile(input)
+	if err != nil {
+		return colorful.Color{}, err
+	}
+	colors := colorHistogram(img)
+	if len(colors) == 0 {
+		return colorful.Color{}, fmt.Errorf("the image has no opaque pixels")
+	}
+
+	candidates := extractPalette(colors, materialCandidates, nil, wuQuantize, extractOptions{
+		Space:  "oklab",
+		Random: rand.New(rand.NewSource(1)),
+	})
+	if seeds := scoreMaterialSeeds(candidates); len(seeds) > 0 {
+		return seeds[0], nil
+	}
+	return materialFallbackSeed, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// OKLab conversions, see https://bottosson.github.io/posts/oklab/.
+
+func okLab(c colorful.Color) (l, a, b float64) {
+	r, g, bl := c.LinearRgb()
+
+	lms0 := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*bl)
+	lms1 := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*bl)
+	lms2 := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*bl)
+
+	l = 0.2104542553*lms0 + 0.7936177850*lms1 - 0.0040720468*lms2
+	a = 1.9779984951*lms0 - 2.4285922050*lms1 + 0.4505937099*lms2
+	b = 0.0259040371*lms0 + 0.7827717662*lms1 - 0.8086757660*lms2
+	return l, a, b
+}
+
+// fromOkLab converts back to sRGB. The result may lie outside the sRGB gamut,
+// check it with IsValid or clamp it.
+func fromOkLab(l, a, b float64) colorful.Color {
+	lms0 := l + 0.3963377774*a + 0.2158037573*b
+	lms1 := l - 0.1055613458*a - 0.0638541728*b
+	lms2 := l - 0.0894841775*a - 1.2914855480*b
+
+	lms0, lms1, lms2 = lms0*lms0*lms0, lms1*lms1*lms1, lms2*lms2*lms2
+
+	return colorful.LinearRgb(
+		+4.0767416621*lms0-3.3077115913*lms1+0.2309699292*lms2,
+		-1.2684380046*lms0+2.6097574011*lms1-0.3413193965*lms2,
+		-0.0041960863*lms0-0.7034186147*lms1+1.7076147010*lms2,
+	)
+}
+
+// okLch returns lightness, chroma and hue in degrees.
+func okLch(c colorful.Color) (l, chroma, hue float64) {
+	l, a, b := okLab(c)
+	chroma = math.Hypot(a, b)
+	hue = math.Mod(math.Atan2(b, a)*180/math.Pi+360, 360)
+	return l, chroma, hue
+}
+
+func fromOkLch(l, chroma, hue float64) colorful.Color {
+	radians := hue * math.Pi / 180
+	return fromOkLab(l, chroma*math.Cos(radians), chroma*math.Sin(radians))
+}
+
+// fromOkLchInGamut is fromOkLch with the chroma reduced as far as needed for
+// the color to fit in sRGB, keeping its lightness and hue.
+func fromOkLchInGamut(l, chroma, hue float64) colorful.Color {
+	c := fromOkLch(l, chroma, hue)
+	if c.IsValid() {
+		return c
+	}
+
+	low, high := 0.0, chroma
+	for i := 0; i < 24; i++ {
+		middle := (low + high) / 2
+		if fromOkLch(l, middle, hue).IsValid() {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return fromOkLch(l, low, hue).Clamped()
+}
+
+// blendOkLab interpolates between a and b in OKLab, t going from 0 for a to 1
+// for b.
+func blendOkLab(a, b colorful.Color, t float64) colorful.Color {
+	l1, a1, b1 := okLab(a)
+	l2, a2, b2 := okLab(b)
+	return fromOkLab(l1+t*(l2-l1), a1+t*(a2-a1), b1+t*(b2-b1))
+}
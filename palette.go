@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Palette is the list of colors an image is mapped to.
+type Palette []PaletteEntry
+
+// PaletteEntry is a palette color, optionally named, weighted or with its own
+// affinity.
+type PaletteEntry struct {
+	ColorfulColor
+	Name string
+	// Weight scales how attractive the entry is in the nearest color search,
+	// 0 means the default of 1.
+	Weight float64
+	// Affinity replaces the global palette affinity when set.
+	Affinity *float64
+
+	// reference is set on the single entry a palette name or a composition
+	// decodes to, until resolvePalettes replaces it with the colors.
+	reference *paletteReference
+}
+
+func (e PaletteEntry) EffectiveWeight() float64 {
+	if e.Weight == 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// Label names the entry in reports: its name, or its hex value when unnamed.
+func (e PaletteEntry) Label() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.Hex()
+}
+
+// UnmarshalYAML reads a plain color or a mapping of color, name, weight and
+// affinity. Problems are reported at the path of the field, like weight.
+func (e *PaletteEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		var color ColorfulColor
+		if err := color.UnmarshalYAML(node); err != nil {
+			return err
+		}
+		*e = PaletteEntry{ColorfulColor: color}
+		return nil
+	}
+
+	var entry PaletteEntry
+	hasColor := false
+
+	pairs, errs := yamlMappingPairs(node)
+	for _, pair := range pairs {
+		key, value := pair[0], resolveYamlAlias(pair[1])
+		var err error
+		switch key.Value {
+		case "color":
+			err = entry.ColorfulColor.UnmarshalYAML(value)
+			hasColor = true
+		case "name":
+			if value.Kind != yaml.ScalarNode || value.Tag != "!!str" {
+				err = yamlNodeErrorf(value, "expected a string, got %s", describeYamlNode(value))
+			}
+			entry.Name = value.Value
+		case "weight":
+			entry.Weight, err = decodeYamlNumber(value)
+			if err == nil && entry.Weight <= 0 {
+				err = yamlNodeErrorf(value, "must be above 0, got %v", entry.Weight)
+			}
+		case "affinity":
+			var affinity float64
+			affinity, err = decodeYamlNumber(value)
+			if err == nil && (affinity < 0 || affinity > 1) {
+				err = yamlNodeErrorf(value, "must be between 0 and 1, got %v", affinity)
+			}
+			entry.Affinity = &affinity
+		default:
+			errs = append(errs, &yamlNodeError{Node: key, Path: key.Value, Message: "unknown key, expected name, color, weight or affinity"})
+		}
+		if err != nil {
+			errs = append(errs, asYamlNodeErrors(value, err).under(key.Value)...)
+		}
+	}
+
+	if !hasColor {
+		errs = append(errs, yamlNodeErrorf(node, "missing color")...)
+	}
+	// A faulty entry is still kept, so that its name counts as used.
+	*e = entry
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func decodeYamlNumber(node *yaml.Node) (float64, error) {
+	var number float64
+	if node.Kind != yaml.ScalarNode || node.Decode(&number) != nil {
+		return 0, yamlNodeErrorf(node, "expected a number, got %s", describeYamlNode(node))
+	}
+	return number, nil
+}
+
+// UnmarshalYAML reads a list of entries, or a palette name or composition
+// left for Settings.resolvePalettes.
+func (p *Palette) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			*p = nil
+			return nil
+		}
+		*p = Palette{{reference: &paletteReference{name: node.Value}}}
+		return nil
+	case yaml.MappingNode:
+		var composition paletteComposition
+		if err := decodeYamlNode(node, &composition); err != nil {
+			return err
+		}
+		*p = Palette{{reference: &paletteReference{composition: &composition}}}
+		return nil
+	case yaml.SequenceNode:
+	default:
+		return yamlNodeErrorf(node, "expected a list of colors, a palette name or a composition")
+	}
+
+	var entries []PaletteEntry
+	err := decodeYamlNode(node, &entries)
+	var errs yamlNodeErrors
+	errors.As(err, &errs)
+
+	// Names tell entries apart in reports and in exclude.
+	namedBy := map[string]int{}
+	for i, entry := range entries {
+		if entry.Name == "" {
+			continue
+		}
+		if first, ok := namedBy[entry.Name]; ok {
+			errs = append(errs, &yamlNodeError{
+				Node:    yamlMappingValue(resolveYamlAlias(node.Content[i]), "name"),
+				Path:    "[" + strconv.Itoa(i) + "].name",
+				Message: fmt.Sprintf("%q is already the name of [%d]", entry.Name, first),
+			})
+			continue
+		}
+		namedBy[entry.Name] = i
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	*p = entries
+	return nil
+}
+
+func (p Palette) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "string", "description": "Name of a palette in the palette library"},
+			map[string]interface{}{"type": "array", "items": PaletteEntry{}.JSONSchema()},
+			paletteCompositionSchema(),
+		},
+	}
+}
+
+func (e PaletteEntry) MarshalYAML() (interface{}, error) {
+	if e.Name == "" && e.Weight == 0 && e.Affinity == nil {
+		return e.Hex(), nil
+	}
+
+	return struct {
+		Name     string   `yaml:"name,omitempty"`
+		Color    string   `yaml:"color"`
+		Weight   float64  `yaml:"weight,omitempty"`
+		Affinity *float64 `yaml:"affinity,omitempty"`
+	}{e.Name, e.Hex(), e.Weight, e.Affinity}, nil
+}
+
+func (e PaletteEntry) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"anyOf": []interface{}{
+			ColorfulColor{}.JSONSchema(),
+			map[string]interface{}{
+				"type":                 "object",
+				"required":             []string{"color"},
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"name":  map[string]interface{}{"type": "string", "description": "Name used in reports and output file name templates"},
+					"color": ColorfulColor{}.JSONSchema(),
+					"weight": map[string]interface{}{
+						"type":             "number",
+						"exclusiveMinimum": 0,
+						"description":      "Below 1 makes the color less attractive to pixels, above 1 more, 1 by default",
+					},
+					"affinity": map[string]interface{}{
+						"type":        "number",
+						"minimum":     0,
+						"maximum":     1,
+						"description": "Replaces palette-affinity for pixels that match this color",
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	aseBlockGroupStart = 0xc001
+	aseBlockGroupEnd   = 0xc002
+	aseBlockColor      = 0x0001
+	aseColorTypeNormal = 2
+
+	acoColorSpaceRGB       = 0
+	acoColorSpaceHSB       = 1
+	acoColorSpaceCMYK      = 2
+	acoColorSpaceLab       = 7
+	acoColorSpaceGrayscale = 8
+)
+
+var errTruncatedPalette = errors.New("file ends in the middle of a color")
+
+// paletteReader reads the big-endian fields Adobe swatch files are made of.
+type paletteReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (pr *paletteReader) read(value interface{}) {
+	if pr.err != nil {
+		return
+	}
+	if err := binary.Read(pr.r, binary.BigEndian, value); err != nil {
+		pr.err = errTruncatedPalette
+	}
+}
+
+func (pr *paletteReader) uint16() uint16 {
+	var value uint16
+	pr.read(&value)
+	return value
+}
+
+func (pr *paletteReader) uint32() uint32 {
+	var value uint32
+	pr.read(&value)
+	return value
+}
+
+// utf16String reads length UTF-16 code units and drops the terminating NUL.
+// Lengths beyond the end of the file are not allocated.
+func (pr *paletteReader) utf16String(length int) string {
+	if pr.err != nil {
+		return ""
+	}
+	if int64(length)*2 > int64(pr.r.Len()) {
+		pr.err = errTruncatedPalette
+		return ""
+	}
+
+	units := make([]uint16, length)
+	pr.read(units)
+	for len(units) > 0 && units[len(units)-1] == 0 {
+		units = units[:len(units)-1]
+	}
+	return string(utf16.Decode(units))
+}
+
+func cmykColor(c, m, y, k float64) colorful.Color {
+	return colorful.Color{R: (1 - c) * (1 - k), G: (1 - m) * (1 - k), B: (1 - y) * (1 - k)}
+}
+
+// readAsePalette reads an Adobe Swatch Exchange file. Groups are flattened,
+// colors in RGB, CMYK, Lab and Gray are converted to sRGB.
+func readAsePalette(raw []byte) (Palette, error) {
+	pr := &paletteReader{r: bytes.NewReader(raw)}
+
+	var signature [4]byte
+	pr.read(&signature)
+	if pr.err != nil || string(signature[:]) != "ASEF" {
+		return nil, errors.New("missing ASEF signature")
+	}
+	pr.uint16()
+	pr.uint16()
+	blocks := pr.uint32()
+
+	var palette Palette
+	for i := uint32(0); i < blocks && pr.err == nil; i++ {
+		blockType := pr.uint16()
+		length := pr.uint32()
+		if pr.err != nil {
+			break
+		}
+		if int64(length) > int64(pr.r.Len()) {
+			return nil, errTruncatedPalette
+		}
+
+		block := make([]byte, length)
+		pr.read(block)
+		if blockType != aseBlockColor {
+			continue
+		}
+
+		entry, err := readAseColor(block)
+		if err != nil {
+			return nil, fmt.Errorf("swatch %d: %w", len(palette), err)
+		}
+		palette = append(palette, entry)
+	}
+
+	return palette, pr.err
+}
+
+func readAseColor(block []byte) (PaletteEntry, error) {
+	pr := &paletteReader{r: bytes.NewReader(block)}
+	name := pr.utf16String(int(pr.uint16()))
+
+	var model [4]byte
+	pr.read(&model)
+
+	var c colorful.Color
+	switch string(model[:]) {
+	case "RGB ":
+		var values [3]float32
+		pr.read(&values)
+		c = colorful.Color{R: float64(values[0]), G: float64(values[1]), B: float64(values[2])}
+	case "CMYK":
+		var values [4]float32
+		pr.read(&values)
+		c = cmykColor(float64(values[0]), float64(values[1]), float64(values[2]), float64(values[3]))
+	case "LAB ":
+		var values [3]float32
+		pr.read(&values)
+		// L* is stored as a fraction of 100, a* and b* as they are, colorful
+		// wants all three divided by 100.
+		c = colorful.Lab(float64(values[0]), float64(values[1])/100, float64(values[2])/100)
+	case "Gray":
+		var value float32
+		pr.read(&value)
+		c = colorful.Color{R: float64(value), G: float64(value), B: float64(value)}
+	default:
+		return PaletteEntry{}, fmt.Errorf("unsupported color model %q", string(model[:]))
+	}
+	if pr.err != nil {
+		return PaletteEntry{}, pr.err
+	}
+
+	return PaletteEntry{ColorfulColor: ColorfulColor{c.Clamped()}, Name: name}, nil
+}
+
+func writeUTF16String(w *bytes.Buffer, value string) {
+	units := append(utf16.Encode([]rune(value)), 0)
+	binary.Write(w, binary.BigEndian, uint16(len(units)))
+	binary.Write(w, binary.BigEndian, units)
+}
+
+func writeAsePalette(w io.Writer, palette Palette) error {
+	var file bytes.Buffer
+	file.WriteString("ASEF")
+	binary.Write(&file, binary.BigEndian, []uint16{1, 0})
+	binary.Write(&file, binary.BigEndian, uint32(len(palette)))
+
+	for _, entry := range palette {
+		var block bytes.Buffer
+		writeUTF16String(&block, entry.Label())
+		block.WriteString("RGB ")
+		c := entry.Clamped()
+		binary.Write(&block, binary.BigEndian, []float32{float32(c.R), float32(c.G), float32(c.B)})
+		binary.Write(&block, binary.BigEndian, uint16(aseColorTypeNormal))
+
+		binary.Write(&file, binary.BigEndian, uint16(aseBlockColor))
+		binary.Write(&file, binary.BigEndian, uint32(block.Len()))
+		file.Write(block.Bytes())
+	}
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// readAcoPalette reads a Photoshop swatches file. The version 2 section that
+// follows the version 1 one is preferred, as only it holds names.
+func readAcoPalette(raw []byte) (Palette, error) {
+	pr := &paletteReader{r: bytes.NewReader(raw)}
+
+	version := pr.uint16()
+	if pr.err != nil || (version != 1 && version != 2) {
+		return nil, errors.New("missing version 1 or 2 header")
+	}
+
+	palette, err := readAcoSection(pr, version)
+	if err != nil || version == 2 || pr.r.Len() == 0 {
+		return palette, err
+	}
+
+	if pr.uint16() != 2 {
+		return palette, nil
+	}
+	return readAcoSection(pr, 2)
+}
+
+func readAcoSection(pr *paletteReader, version uint16) (Palette, error) {
+	count := int(pr.uint16())
+
+	var palette Palette
+	for i := 0; i < count && pr.err == nil; i++ {
+		space := pr.uint16()
+		var values [4]uint16
+		pr.read(&values)
+
+		name := ""
+		if version == 2 {
+			name = pr.utf16String(int(pr.uint32()))
+		}
+		if pr.err != nil {
+			break
+		}
+
+		var c colorful.Color
+		switch space {
+		case acoColorSpaceRGB:
+			c = colorful.Color{R: float64(values[0]) / 65535, G: float64(values[1]) / 65535, B: float64(values[2]) / 65535}
+		case acoColorSpaceHSB:
+			c = colorful.Hsv(float64(values[0])/65535*360, float64(values[1])/65535, float64(values[2])/65535)
+		case acoColorSpaceCMYK:
+			// 0 is full ink.
+			c = cmykColor(1-float64(values[0])/65535, 1-float64(values[1])/65535, 1-float64(values[2])/65535, 1-float64(values[3])/65535)
+		case acoColorSpaceLab:
+			c = colorful.Lab(float64(values[0])/10000, float64(int16(values[1]))/10000, float64(int16(values[2]))/10000)
+		case acoColorSpaceGrayscale:
+			gray := 1 - math.Min(float64(values[0])/10000, 1)
+			c = colorful.Color{R: gray, G: gray, B: gray}
+		default:
+			return nil, fmt.Errorf("swatch %d: unsupported color space %d", i, space)
+		}
+
+		palette = append(palette, PaletteEntry{ColorfulColor: ColorfulColor{c.Clamped()}, Name: name})
+	}
+
+	return palette, pr.err
+}
+
+// writeAcoPalette writes a version 1 section followed by a version 2 one with
+// names, as Photoshop does.
+func writeAcoPalette(w io.Writer, palette Palette) error {
+	var file bytes.Buffer
+	for _, version := range []uint16{1, 2} {
+		binary.Write(&file, binary.BigEndian, []uint16{version, uint16(len(palette))})
+		for _, entry := range palette {
+			c := entry.Clamped()
+			binary.Write(&file, binary.BigEndian, []uint16{
+				acoColorSpaceRGB,
+				uint16(math.Round(c.R * 65535)), uint16(math.Round(c.G * 65535)), uint16(math.Round(c.B * 65535)),
+				0,
+			})
+			if version == 2 {
+				units := append(utf16.Encode([]rune(entry.Label())), 0)
+				binary.Write(&file, binary.BigEndian, uint32(len(units)))
+				binary.Write(&file, binary.BigEndian, units)
+			}
+		}
+	}
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+var paletteCommand = &cli.Command{
+	Name:  "palette",
+	Usage: "Work with palette files",
+	Subcommands: []*cli.Command{
+		{
+			Name: "convert",
+			Usage: "Convert a palette file between formats: " + strings.Join(paletteFormatNames(), ", ") +
+				".\nExample usage: img2theme palette convert theme.ase theme.yaml",
+			ArgsUsage: "INPUT OUTPUT",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "from",
+					Usage: "`FORMAT` of the input, told by its extension by default",
+				},
+				&cli.StringFlag{
+					Name:  "to",
+					Usage: "`FORMAT` of the output, told by its extension by default",
+				},
+			},
+			Action: paletteConvertAction,
+		},
+		{
+			Name: "generate",
+			Usage: "Generate a palette of lightness ramps for the hues of a harmony around a seed color, written as settings.\n" +
+				"Example usage: img2theme palette generate --seed '#88c0d0' --harmony triadic --shades 5 >palette.yaml",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "seed",
+					Usage:    "`COLOR` the harmony is built around",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "harmony",
+					Usage: "one of " + strings.Join(harmonyNames(), ", "),
+					Value: "complementary",
+				},
+				&cli.IntFlag{
+					Name:  "shades",
+					Usage: "number of shades in every ramp, from dark to light",
+					Value: 5,
+				},
+				&cli.StringFlag{
+					Name:  "space",
+					Usage: "space the ramps are built in: " + strings.Join(generateSpaces, " or "),
+					Value: "oklch",
+				},
+				&cli.StringFlag{
+					Name:  "to",
+					Usage: "write the palette in `FORMAT` instead of as settings",
+				},
+			},
+			Action: paletteGenerateAction,
+		},
+		{
+			Name: "inspect",
+			Usage: "Judge the palette of the settings: swatches, ΔE between entries by the configured metric, WCAG and APCA contrast of every pair and gaps in lightness and hue.\n" +
+				"Example usage: img2theme palette inspect settings.yaml",
+			ArgsUsage: "[settings.yaml...]",
+			Flags: append(settingsFlags(),
+				&cli.Float64Flag{
+					Name:  "near-duplicate",
+					Usage: "ΔE below which two entries are flagged as near-duplicates",
+					Value: 3,
+				},
+				&cli.StringFlag{
+					Name:  "color",
+					Usage: "print color swatches: auto, always or never",
+					Value: "auto",
+				},
+			),
+			Action: paletteInspectAction,
+		},
+	},
+}
+
+// paletteConvertAction reads a palette and writes it in another format. "-"
+// stands for stdin or stdout, whose format must then be given.
+func paletteConvertAction(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("expected an input and an output file, got %d arguments", c.NArg())
+	}
+	inputPath, outputPath := c.Args().Get(0), c.Args().Get(1)
+
+	from, err := paletteFormatByName(c.String("from"), inputPath)
+	if err != nil {
+		return err
+	}
+	to, err := paletteFormatByName(c.String("to"), outputPath)
+	if err != nil {
+		return err
+	}
+	if to.Write == nil {
+		return fmt.Errorf("%s palettes can be read but not written", to.Name)
+	}
+
+	var raw []byte
+	if inputPath == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(inputPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	palette, err := from.Read(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", inputPath, err)
+	}
+	if len(palette) == 0 {
+		return fmt.Errorf("%s: holds no colors", inputPath)
+	}
+
+	var output bytes.Buffer
+	if err := to.Write(&output, palette); err != nil {
+		return err
+	}
+
+	if outputPath == "-" {
+		_, err = os.Stdout.Write(output.Bytes())
+		return err
+	}
+	return writeFileAtomic(outputPath, output.Bytes())
+}
+
+func paletteGenerateAction(c *cli.Context) error {
+	seed, err := parseColorString(c.String("seed"))
+	if err != nil {
+		return fmt.Errorf("--seed %q: %w", c.String("seed"), err)
+	}
+	palette, err := generatePalette(seed, c.String("harmony"), c.Int("shades"), c.String("space"))
+	if err != nil {
+		return err
+	}
+
+	if c.String("to") != "" {
+		format, err := paletteFormatByName(c.String("to"), "")
+		if err != nil {
+			return err
+		}
+		if format.Write == nil {
+			return fmt.Errorf("%s palettes can be read but not written", format.Name)
+		}
+		return format.Write(os.Stdout, palette)
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(output, "# %s palette of seed %s built in %s, ramps of %d shades\n", c.String("harmony"), seed.Hex(), c.String("space"), c.Int("shades"))
+	fmt.Fprintln(output, "palette:")
+	for _, entry := range palette {
+		fmt.Fprintf(output, "  - {name: %s, color: '%s'}\n", entry.Name, entry.Hex())
+	}
+	return output.Flush()
+}
+
+func paletteInspectAction(c *cli.Context) error {
+	swatches, err := useSwatches(c.String("color"), os.Stdout)
+	if err != nil {
+		return err
+	}
+	settings, err := loadSettings(c)
+	if err != nil {
+		return err
+	}
+	if len(settings.Palette) == 0 {
+		return fmt.Errorf("the settings hold no palette")
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	inspection := paletteInspection{
+		Palette:       settings.Palette,
+		MetricName:    settings.Metric,
+		NearDuplicate: c.Float64("near-duplicate"),
+		Swatches:      swatches,
+	}
+	if err := inspection.Write(output); err != nil {
+		return err
+	}
+	return output.Flush()
+}
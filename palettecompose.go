@@ -0,0 +1,451 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultShadeStep = 0.08
+	// defaultImageColors and defaultImageAlgorithm are how palettes are
+	// extracted from reference images unless told otherwise.
+	defaultImageColors    = 8
+	defaultImageAlgorithm = "wu"
+	// achromaticChroma is the OKLCh chroma below which a color counts as a
+	// gray whose hue means nothing.
+	achromaticChroma = 0.02
+)
+
+// paletteComposition builds a palette out of others. The steps apply in the
+// order of the fields: file, from-image, union, exclude, filter, add, expand.
+type paletteComposition struct {
+	File      string           `yaml:"file"`
+	FromImage string           `yaml:"from-image"`
+	Colors    int              `yaml:"colors"`
+	Algorithm string           `yaml:"algorithm"`
+	Union     []Palette        `yaml:"union"`
+	Exclude   []string         `yaml:"exclude"`
+	Filter    paletteFilter    `yaml:"filter"`
+	Add       Palette          `yaml:"add"`
+	Expand    paletteExpansion `yaml:"expand"`
+}
+
+// paletteFilter keeps the colors within every given [min, max] OKLCh range.
+// A hue range with min above max wraps around 360.
+type paletteFilter struct {
+	Lightness []float64 `yaml:"lightness"`
+	Chroma    []float64 `yaml:"chroma"`
+	Hue       []float64 `yaml:"hue"`
+}
+
+// paletteExpansion adds Shades lighter and Shades darker variants of every
+// color, Step apart in OKLCh lightness.
+type paletteExpansion struct {
+	Shades int     `yaml:"shades"`
+	Step   float64 `yaml:"step"`
+}
+
+// paletteReference is a palette decoded by name or as a composition.
+type paletteReference struct {
+	name        string
+	composition *paletteComposition
+	// baseDir is what relative paths of the composition are resolved
+	// against, recorded by locatePalettes.
+	baseDir string
+	located bool
+}
+
+// settingsPalette is a palette of the settings and the path of its key.
+type settingsPalette struct {
+	path    string
+	palette *Palette
+}
+
+func (s *Settings) palettes() []settingsPalette {
+	palettes := []settingsPalette{{"palette", &s.Palette}}
+	for i := range s.Mappings {
+		palettes = append(palettes, settingsPalette{fmt.Sprintf("mappings[%d].palette", i), &s.Mappings[i].Palette})
+	}
+	return palettes
+}
+
+// locatePalettes records baseDir, the directory of the settings file or
+// empty for the working directory, on the palettes that were just decoded.
+func (s *Settings) locatePalettes(baseDir string) {
+	for _, p := range s.palettes() {
+		if len(*p.palette) == 1 && (*p.palette)[0].reference != nil && !(*p.palette)[0].reference.located {
+			(*p.palette)[0].reference.baseDir = baseDir
+			(*p.palette)[0].reference.located = true
+		}
+	}
+}
+
+// resolvePalettes loads the named palettes and builds the compositions of
+// s. A palette that fails is left out.
+func (s *Settings) resolvePalettes() []SettingsProblem {
+	var problems []SettingsProblem
+	for _, p := range s.palettes() {
+		baseDir := ""
+		if len(*p.palette) == 1 && (*p.palette)[0].reference != nil {
+			baseDir = (*p.palette)[0].reference.baseDir
+		}
+		resolved, err := p.palette.resolve(baseDir)
+		if err != nil {
+			problems = append(problems, SettingsProblem{Path: p.path, Message: err.Error()})
+		}
+		*p.palette = resolved
+	}
+	return problems
+}
+
+// resolve turns a decoded reference into its colors, relative paths against
+// baseDir, other palettes are returned as they are.
+func (p Palette) resolve(baseDir string) (Palette, error) {
+	if len(p) != 1 || p[0].reference == nil {
+		return p, nil
+	}
+	if p[0].reference.composition == nil {
+		return loadNamedPalette(p[0].reference.name)
+	}
+	return p[0].reference.composition.resolve(baseDir)
+}
+
+func (pc paletteComposition) resolve(baseDir string) (Palette, error) {
+	for i, part := range pc.Union {
+		resolved, err := part.resolve(baseDir)
+		if err != nil {
+			return nil, err
+		}
+		pc.Union[i] = resolved
+	}
+	add, err := pc.Add.resolve(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	pc.Add = add
+
+	var palette Palette
+	if pc.File != "" {
+		filePath, err := resolvePaletteFilePath(pc.File, baseDir)
+		if err != nil {
+			return nil, err
+		}
+
+		palette, err = loadPaletteFile(filePath)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file %q not found at %s", pc.File, filePath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("file %q: %w", pc.File, err)
+		}
+	}
+
+	if pc.FromImage != "" {
+		extracted, err := pc.extractFromImage(baseDir)
+		if err != nil {
+			return nil, err
+		}
+		palette = append(palette, extracted...)
+	} else if pc.Colors != 0 {
+		return nil, fmt.Errorf("%q only applies to from-image", "colors")
+	} else if pc.Algorithm != "" {
+		return nil, fmt.Errorf("%q only applies to from-image", "algorithm")
+	}
+
+	for _, part := range pc.Union {
+		palette = append(palette, part...)
+	}
+
+	palette, err = excludeFromPalette(palette, pc.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	palette, err = pc.Filter.apply(palette)
+	if err != nil {
+		return nil, err
+	}
+
+	palette = append(palette, pc.Add...)
+
+	palette, err = pc.Expand.apply(palette)
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutDuplicateColors(palette), nil
+}
+
+// resolvePaletteFilePath expands a leading ~/ and resolves relative paths
+// against baseDir.
+func resolvePaletteFilePath(filePath, baseDir string) (string, error) {
+	if strings.HasPrefix(filePath, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		filePath = filepath.Join(home, filePath[2:])
+	}
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(baseDir, filePath)
+	}
+	return filePath, nil
+}
+
+// extractFromImage quantizes the reference image with seeded k-means, so the
+// same image always gives the same palette.
+func (pc paletteComposition) extractFromImage(baseDir string) (Palette, error) {
+	colors := pc.Colors
+	if colors == 0 {
+		colors = defaultImageColors
+	}
+	if colors < 0 {
+		return nil, fmt.Errorf("colors must be at least 1, got %d", colors)
+	}
+	name := pc.Algorithm
+	if name == "" {
+		name = defaultImageAlgorithm
+	}
+	algorithm, ok := extractAlgorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("algorithm %q is unknown, expected one of %s", name, strings.Join(extractAlgorithmNames(), ", "))
+	}
+
+	imagePath, err := resolvePaletteFilePath(pc.FromImage, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(imagePath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("from-image %q not found at %s", pc.FromImage, imagePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err := loadImageFromFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("from-image %q: %w", pc.FromImage, err)
+	}
+	histogram := colorHistogram(img)
+	if len(histogram) == 0 {
+		return nil, fmt.Errorf("from-image %q has no opaque pixels", pc.FromImage)
+	}
+
+	extracted := extractPalette(histogram, colors, nil, algorithm, extractOptions{
+		Space:  "oklab",
+		Random: rand.New(rand.NewSource(1)),
+	})
+	palette := make(Palette, len(extracted))
+	for i, c := range extracted {
+		palette[i] = PaletteEntry{ColorfulColor: ColorfulColor{c.Color}}
+	}
+	return palette, nil
+}
+
+// excludeFromPalette drops the entries named by exclude, or, for values that
+// name no entry, the entries of that color.
+func excludeFromPalette(palette Palette, exclude []string) (Palette, error) {
+	excludedNames := map[string]bool{}
+	excludedColors := map[string]bool{}
+
+	for _, value := range exclude {
+		named := false
+		for _, entry := range palette {
+			named = named || entry.Name == value
+		}
+		if named {
+			excludedNames[value] = true
+			continue
+		}
+
+		color, err := parseColor(value)
+		if err != nil {
+			return nil, fmt.Errorf("exclude %q is neither the name of an entry nor a color", value)
+		}
+		excludedColors[color.Hex()] = true
+	}
+
+	kept := Palette{}
+	for _, entry := range palette {
+		if !excludedNames[entry.Name] && !excludedColors[entry.Hex()] {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+func (pf paletteFilter) apply(palette Palette) (Palette, error) {
+	for _, bounds := range []struct {
+		name   string
+		values []float64
+	}{{"lightness", pf.Lightness}, {"chroma", pf.Chroma}, {"hue", pf.Hue}} {
+		if bounds.values != nil && len(bounds.values) != 2 {
+			return nil, fmt.Errorf("filter %s must be a [min, max] pair, got %v", bounds.name, bounds.values)
+		}
+	}
+
+	kept := Palette{}
+	for _, entry := range palette {
+		l, chroma, hue := okLch(entry.Color)
+
+		if pf.Lightness != nil && (l < pf.Lightness[0] || l > pf.Lightness[1]) {
+			continue
+		}
+		if pf.Chroma != nil && (chroma < pf.Chroma[0] || chroma > pf.Chroma[1]) {
+			continue
+		}
+		if pf.Hue != nil && (chroma < achromaticChroma || !hueWithin(hue, pf.Hue[0], pf.Hue[1])) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept, nil
+}
+
+func hueWithin(hue, min, max float64) bool {
+	min, max = math.Mod(min+360, 360), math.Mod(max+360, 360)
+	if min <= max {
+		return hue >= min && hue <= max
+	}
+	return hue >= min || hue <= max
+}
+
+func (pe paletteExpansion) apply(palette Palette) (Palette, error) {
+	if pe.Shades < 0 {
+		return nil, fmt.Errorf("expand shades must not be negative, got %d", pe.Shades)
+	}
+	if pe.Shades == 0 {
+		return palette, nil
+	}
+	step := pe.Step
+	if step == 0 {
+		step = defaultShadeStep
+	}
+	if step < 0 || step >= 1 {
+		return nil, fmt.Errorf("expand step must be between 0 and 1, got %v", step)
+	}
+
+	expanded := make(Palette, 0, len(palette)*(2*pe.Shades+1))
+	for _, entry := range palette {
+		expanded = append(expanded, entry)
+
+		l, chroma, hue := okLch(entry.Color)
+		for i := 1; i <= pe.Shades; i++ {
+			for _, shade := range []struct {
+				suffix    string
+				lightness float64
+			}{
+				{"lighter", l + step*float64(i)},
+				{"darker", l - step*float64(i)},
+			} {
+				if shade.lightness <= 0 || shade.lightness >= 1 {
+					continue
+				}
+
+				variant := entry
+				variant.ColorfulColor = ColorfulColor{fromOkLchInGamut(shade.lightness, chroma, hue)}
+				if entry.Name != "" {
+					variant.Name = fmt.Sprintf("%s-%s-%d", entry.Name, shade.suffix, i)
+				}
+				expanded = append(expanded, variant)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// withoutDuplicateColors keeps the first entry of every color.
+func withoutDuplicateColors(palette Palette) Palette {
+	seen := map[string]bool{}
+	unique := make(Palette, 0, len(palette))
+	for _, entry := range palette {
+		if !seen[entry.Hex()] {
+			seen[entry.Hex()] = true
+			unique = append(unique, entry)
+		}
+	}
+	return unique
+}
+
+func paletteCompositionSchema() map[string]interface{} {
+	paletteRef := map[string]interface{}{
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": PaletteEntry{}.JSONSchema()},
+			map[string]interface{}{"type": "object"},
+		},
+	}
+	rangeSchema := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "number"},
+			"minItems":    2,
+			"maxItems":    2,
+			"description": description,
+		}
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"description":          "Applied in order: file, from-image, union, exclude, filter, add, expand",
+		"properties": map[string]interface{}{
+			"file": map[string]interface{}{
+				"type":        "string",
+				"description": "Palette or terminal theme file to start from, relative to the settings file, one of " + strings.Join(paletteFileExtensions(), ", "),
+			},
+			"from-image": map[string]interface{}{
+				"type":        "string",
+				"description": "Reference image to extract colors from, relative to the settings file",
+			},
+			"colors": map[string]interface{}{
+				"type":        "integer",
+				"minimum":     1,
+				"description": "Colors to extract from from-image, 8 by default",
+			},
+			"algorithm": map[string]interface{}{
+				"type":        "string",
+				"enum":        append(extractAlgorithmNames(), ""),
+				"description": "Quantizer used on from-image, wu by default, k-means is seeded for reproducibility",
+			},
+			"union": map[string]interface{}{
+				"type":        "array",
+				"items":       paletteRef,
+				"description": "Palettes, by name, as lists or as compositions, to combine",
+			},
+			"exclude": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Entry names or colors to leave out",
+			},
+			"filter": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"lightness": rangeSchema("Kept OKLCh lightness range, from 0 to 1"),
+					"chroma":    rangeSchema("Kept OKLCh chroma range, from 0 to about 0.37"),
+					"hue":       rangeSchema("Kept OKLCh hue range in degrees, min above max wraps around, grays never match"),
+				},
+			},
+			"add": map[string]interface{}{
+				"type":        "array",
+				"items":       PaletteEntry{}.JSONSchema(),
+				"description": "Colors to add",
+			},
+			"expand": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"shades": map[string]interface{}{"type": "integer", "minimum": 0, "description": "Lighter and darker shades to add for every color"},
+					"step":   map[string]interface{}{"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1, "description": "OKLCh lightness between shades, 0.08 by default"},
+				},
+			},
+		},
+	}
+}
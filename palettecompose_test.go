@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// composedPalette merges a settings file of the given palette and returns it
+// as "name=#hex" strings, the name left out of unnamed entries.
+func composedPalette(t *testing.T, source, palette string) []string {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	settings, err := mergeSettingsLayers([]settingsLayer{fileLayer(source, "palette: "+palette+"\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make([]string, len(settings.Palette))
+	for i, entry := range settings.Palette {
+		entries[i] = entry.Hex()
+		if entry.Name != "" {
+			entries[i] = entry.Name + "=" + entries[i]
+		}
+	}
+	return entries
+}
+
+func expectPalette(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got palette\n\t%s\nwant\n\t%s", strings.Join(got, " "), strings.Join(want, " "))
+	}
+}
+
+func TestPaletteComposition(t *testing.T) {
+	// Nord without the aurora red and orange, by name and by color.
+	got := composedPalette(t, "s.yaml", `{union: [nord], exclude: [nord11, "#d08770"], filter: {chroma: [0.05, 1]}}`)
+	expectPalette(t, got, "nord8=#88c0d0", "nord9=#81a1c1", "nord10=#5e81ac", "nord13=#ebcb8b", "nord14=#a3be8c", "nord15=#b48ead")
+
+	// The dark half of Nord plus pure black, the repeated #2e3440 kept once.
+	got = composedPalette(t, "s.yaml", `{union: [nord], filter: {lightness: [0, 0.5]}, add: ["#000000", "#2e3440"]}`)
+	expectPalette(t, got, "nord0=#2e3440", "nord1=#3b4252", "nord2=#434c5e", "nord3=#4c566a", "#000000")
+
+	// Hue ranges wrap around 360 and leave grays out.
+	got = composedPalette(t, "s.yaml", `{union: [["#ff0000", "#ff00ff", "#00ff00", "#808080"]], filter: {hue: [300, 40]}}`)
+	expectPalette(t, got, "#ff0000", "#ff00ff")
+
+	got = composedPalette(t, "s.yaml", `{add: [{name: mid, color: "#808080"}], expand: {shades: 2, step: 0.1}}`)
+	if len(got) != 5 || !strings.HasPrefix(got[1], "mid-lighter-1=") || !strings.HasPrefix(got[4], "mid-darker-2=") {
+		t.Fatalf("got %v, want mid and two shades each way", got)
+	}
+	settings, err := mergeSettingsLayers([]settingsLayer{fileLayer("s.yaml", "palette: {add: ['#808080'], expand: {shades: 1, step: 0.1}}\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, _, _ := okLch(settings.Palette[0].Color)
+	for i, want := range []float64{l, l + 0.1, l - 0.1} {
+		if got, _, _ := okLch(settings.Palette[i].Color); math.Abs(got-want) > 0.005 {
+			t.Errorf("[%d]: lightness %.3f, want %.3f", i, got, want)
+		}
+	}
+}
+
+func TestPaletteCompositionFilesAreRelativeToSettings(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mine.hex"), []byte("112233\n445566\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := composedPalette(t, filepath.Join(dir, "s.yaml"), `{file: mine.hex, exclude: ["#445566"]}`)
+	expectPalette(t, got, "#112233")
+}
+
+func TestPaletteCompositionProblems(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for palette, message := range map[string]string{
+		`{union: [nord], exclude: [nord16]}`:            `exclude "nord16" is neither the name of an entry nor a color`,
+		`{union: [nord], filter: {hue: [10]}}`:          "filter hue must be a [min, max] pair",
+		`{union: [nord], expand: {shades: -1}}`:         "expand shades must not be negative",
+		`{union: [nord], expand: {shades: 1, step: 1}}`: "expand step must be between 0 and 1",
+		`{file: missing.hex}`:                           `file "missing.hex" not found`,
+		`{union: [nord], colors: 4}`:                    `"colors" only applies to from-image`,
+	} {
+		got := settingsProblems(t, fileLayer("s.yaml", "palette: "+palette+"\n"))
+		if len(got) != 1 || !strings.Contains(got[0], message) {
+			t.Errorf("%s: got problems %q, want one mentioning %q", palette, got, message)
+		}
+	}
+}
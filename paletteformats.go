@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxSwatchStripColors bounds how many distinct colors an image may hold
+	// to be read as a swatch strip rather than a picture.
+	maxSwatchStripColors = 1024
+	swatchStripSize      = 32
+	// maxJascColors bounds the color count a JASC palette may declare, the
+	// format was made for 256 colors at most.
+	maxJascColors = 1 << 16
+)
+
+// paletteFormat reads and writes palettes in a file format of another tool.
+// Write is nil for formats that can only be read, like terminal themes.
+type paletteFormat struct {
+	Name       string
+	Extensions []string
+	Read       func(raw []byte) (Palette, error)
+	Write      func(w io.Writer, palette Palette) error
+}
+
+var paletteFormats = []paletteFormat{
+	{Name: "yaml", Extensions: []string{".yaml", ".yml"}, Read: readYamlPalette, Write: writeYamlPalette},
+	{Name: "gpl", Extensions: []string{".gpl"}, Read: readGplPalette, Write: writeGplPalette},
+	{Name: "ase", Extensions: []string{".ase"}, Read: readAsePalette, Write: writeAsePalette},
+	{Name: "aco", Extensions: []string{".aco"}, Read: readAcoPalette, Write: writeAcoPalette},
+	{Name: "pal", Extensions: []string{".pal"}, Read: readJascPalette, Write: writeJascPalette},
+	{Name: "hex", Extensions: []string{".hex"}, Read: readHexPalette, Write: writeHexPalette},
+	{Name: "png", Extensions: []string{".png"}, Read: readSwatchStripPalette, Write: writeSwatchStripPalette},
+	{Name: "xresources", Extensions: []string{".xresources", ".xdefaults"}, Read: readXresourcesPalette},
+	{Name: "kitty", Extensions: []string{".conf"}, Read: readKittyPalette},
+	{Name: "foot", Extensions: []string{".ini"}, Read: readFootPalette},
+	{Name: "toml", Extensions: []string{".toml"}, Read: readTomlPalette},
+	{Name: "windows-terminal", Extensions: []string{".json"}, Read: readWindowsTerminalPalette},
+	{Name: "iterm2", Extensions: []string{".itermcolors"}, Read: readItermPalette},
+}
+
+func paletteFormatNames() []string {
+	names := make([]string, len(paletteFormats))
+	for i, format := range paletteFormats {
+		names[i] = format.Name
+	}
+	return names
+}
+
+// paletteFileExtensions lists the extensions of every readable palette file.
+func paletteFileExtensions() []string {
+	var extensions []string
+	for _, format := range paletteFormats {
+		extensions = append(extensions, format.Extensions...)
+	}
+	return extensions
+}
+
+// paletteFormatByName finds a format by name, or when name is empty by the
+// extension of fileName.
+func paletteFormatByName(name, fileName string) (paletteFormat, error) {
+	extension := strings.ToLower(filepath.Ext(fileName))
+	for _, format := range paletteFormats {
+		if format.Name == name {
+			return format, nil
+		}
+		for _, known := range format.Extensions {
+			if name == "" && known == extension {
+				return format, nil
+			}
+		}
+	}
+
+	if name != "" {
+		return paletteFormat{}, fmt.Errorf("unknown palette format %q, expected one of %s", name, strings.Join(paletteFormatNames(), ", "))
+	}
+	return paletteFormat{}, fmt.Errorf("cannot tell the palette format of %q, expected one of the extensions %s",
+		fileName, strings.Join(paletteFileExtensions(), ", "))
+}
+
+// readYamlPalette reads a list of palette entries, or a mapping as a base16
+// or alacritty theme.
+func readYamlPalette(raw []byte) (Palette, error) {
+	document, err := parseYamlDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	if document != nil && document.Kind == yaml.MappingNode {
+		return readYamlThemePalette(raw)
+	}
+	if document == nil || document.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("expected a list of colors, a base16 scheme or an alacritty config")
+	}
+
+	var palette Palette
+	if err := decodeYamlNode(document, &palette); err != nil {
+		return nil, err
+	}
+	return palette, nil
+}
+
+func writeYamlPalette(w io.Writer, palette Palette) error {
+	raw, err := yaml.Marshal(palette)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+func rgb255Entry(r, g, b int, name string) PaletteEntry {
+	return PaletteEntry{
+		ColorfulColor: ColorfulColor{colorFromPackedRGB(uint32(r)<<16 | uint32(g)<<8 | uint32(b))},
+		Name:          name,
+	}
+}
+
+func parseChannel(raw string) (int, error) {
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 || value > 255 {
+		return 0, fmt.Errorf("invalid color channel %q, expected 0 to 255", raw)
+	}
+	return value, nil
+}
+
+// readGplPalette reads a GIMP palette: a "GIMP Palette" header, optional
+// Name and Columns lines, then "R G B name" lines.
+func readGplPalette(raw []byte) (Palette, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "GIMP Palette" {
+		return nil, fmt.Errorf("missing GIMP Palette header")
+	}
+
+	var palette Palette
+	for lineNumber := 2; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "Name:") || strings.HasPrefix(line, "Columns:") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected R G B and an optional name", lineNumber)
+		}
+		var channels [3]int
+		for i := range channels {
+			value, err := parseChannel(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			channels[i] = value
+		}
+
+		name := strings.Join(fields[3:], " ")
+		if name == "Untitled" {
+			name = ""
+		}
+		palette = append(palette, rgb255Entry(channels[0], channels[1], channels[2], name))
+	}
+
+	return palette, scanner.Err()
+}
+
+func writeGplPalette(w io.Writer, palette Palette) error {
+	buffered := bufio.NewWriter(w)
+	fmt.Fprintf(buffered, "GIMP Palette\nName: img2theme\nColumns: 0\n#\n")
+	for _, entry := range palette {
+		r, g, b := entry.Clamped().RGB255()
+		name := entry.Name
+		if name == "" {
+			name = entry.Hex()
+		}
+		fmt.Fprintf(buffered, "%3d %3d %3d\t%s\n", r, g, b, name)
+	}
+	return buffered.Flush()
+}
+
+// readJascPalette reads a JASC/Paint Shop Pro palette: "JASC-PAL", a version,
+// a color count, then "R G B" lines.
+func readJascPalette(raw []byte) (Palette, error) {
+	lines := strings.Split(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+	if len(lines) < 3 || strings.TrimSpace(lines[0]) != "JASC-PAL" {
+		return nil, fmt.Errorf("missing JASC-PAL header")
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(lines[2]))
+	if err != nil || count < 0 || count > maxJascColors {
+		return nil, fmt.Errorf("line 3: invalid color count %q, expected 0 to %d", strings.TrimSpace(lines[2]), maxJascColors)
+	}
+	if len(lines)-3 < count {
+		return nil, fmt.Errorf("expected %d colors, found %d lines", count, len(lines)-3)
+	}
+
+	palette := make(Palette, 0, count)
+	for i, line := range lines[3 : 3+count] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected R G B", i+4)
+		}
+		var channels [3]int
+		for c := range channels {
+			value, err := parseChannel(fields[c])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+4, err)
+			}
+			channels[c] = value
+		}
+		palette = append(palette, rgb255Entry(channels[0], channels[1], channels[2], ""))
+	}
+
+	return palette, nil
+}
+
+func writeJascPalette(w io.Writer, palette Palette) error {
+	buffered := bufio.NewWriter(w)
+	fmt.Fprintf(buffered, "JASC-PAL\r\n0100\r\n%d\r\n", len(palette))
+	for _, entry := range palette {
+		r, g, b := entry.Clamped().RGB255()
+		fmt.Fprintf(buffered, "%d %d %d\r\n", r, g, b)
+	}
+	return buffered.Flush()
+}
+
+// readHexPalette reads a Lospec .hex file, one RRGGBB color per line.
+func readHexPalette(raw []byte) (Palette, error) {
+	var palette Palette
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		color, err := parseHexDigits(strings.TrimPrefix(line, "#"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %q: %w", i+1, line, err)
+		}
+		palette = append(palette, PaletteEntry{ColorfulColor: ColorfulColor{color}})
+	}
+	return palette, nil
+}
+
+func writeHexPalette(w io.Writer, palette Palette) error {
+	buffered := bufio.NewWriter(w)
+	for _, entry := range palette {
+		fmt.Fprintln(buffered, strings.TrimPrefix(entry.Clamped().Hex(), "#"))
+	}
+	return buffered.Flush()
+}
+
+// readSwatchStripPalette reads the distinct opaque colors of an image in the
+// order they first appear.
+func readSwatchStripPalette(raw []byte) (Palette, error) {
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var palette Palette
+	seen := map[uint32]bool{}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+
+			key := (r>>8)<<16 | (g>>8)<<8 | b>>8
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if len(seen) > maxSwatchStripColors {
+				return nil, fmt.Errorf("image has more than %d colors, expected a swatch strip", maxSwatchStripColors)
+			}
+			palette = append(palette, PaletteEntry{ColorfulColor: ColorfulColor{colorFromPackedRGB(key)}})
+		}
+	}
+	return palette, nil
+}
+
+func writeSwatchStripPalette(w io.Writer, palette Palette) error {
+	if len(palette) == 0 {
+		return fmt.Errorf("cannot write an empty palette as an image")
+	}
+
+	strip := image.NewRGBA(image.Rect(0, 0, swatchStripSize*len(palette), swatchStripSize))
+	for i, entry := range palette {
+		r, g, b := entry.Clamped().RGB255()
+		swatch := image.Rect(i*swatchStripSize, 0, (i+1)*swatchStripSize, swatchStripSize)
+		draw.Draw(strip, swatch, image.NewUniform(color.RGBA{R: r, G: g, B: b, A: 255}), image.Point{}, draw.Src)
+	}
+	return png.Encode(w, strip)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testPalette() Palette {
+	return Palette{
+		rgb255Entry(0x1d, 0x20, 0x21, "background"),
+		rgb255Entry(0xcc, 0x24, 0x1d, "red"),
+		rgb255Entry(0xfb, 0xf1, 0xc7, "foreground"),
+	}
+}
+
+func TestPaletteFormatsRoundTrip(t *testing.T) {
+	want := testPalette()
+	for _, name := range []string{"yaml", "gpl", "ase", "aco", "pal", "hex", "png"} {
+		format, err := paletteFormatByName(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var written bytes.Buffer
+		if err := format.Write(&written, want); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := format.Read(written.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d colors, want %d", name, len(got), len(want))
+		}
+		keepsNames := name == "yaml" || name == "gpl" || name == "ase" || name == "aco"
+		for i := range want {
+			if got[i].Hex() != want[i].Hex() {
+				t.Errorf("%s: color %d: got %s, want %s", name, i, got[i].Hex(), want[i].Hex())
+			}
+			if keepsNames && got[i].Name != want[i].Name {
+				t.Errorf("%s: color %d: got name %q, want %q", name, i, got[i].Name, want[i].Name)
+			}
+		}
+	}
+}
+
+func TestPaletteFormatsRejectMalformedFiles(t *testing.T) {
+	written := map[string][]byte{}
+	for _, name := range []string{"ase", "aco"} {
+		format, _ := paletteFormatByName(name, "")
+		var buffer bytes.Buffer
+		if err := format.Write(&buffer, testPalette()); err != nil {
+			t.Fatal(err)
+		}
+		written[name] = buffer.Bytes()
+	}
+
+	for _, test := range []struct {
+		format, name string
+		raw          []byte
+		message      string
+	}{
+		{"gpl", "missing header", []byte("0 0 0 black\n"), "GIMP Palette header"},
+		{"gpl", "missing channel", []byte("GIMP Palette\n0 0\n"), "line 2"},
+		{"gpl", "channel out of range", []byte("GIMP Palette\nName: test\n0 256 0 green\n"), "line 3"},
+		{"ase", "missing signature", []byte("ASEX"), "ASEF"},
+		{"ase", "truncated", written["ase"][:len(written["ase"])-5], "ends in the middle"},
+		{"aco", "unknown version", []byte{0, 3, 0, 0}, "version"},
+		{"aco", "truncated", written["aco"][:7], "ends in the middle"},
+		{"pal", "missing header", []byte("0100\n1\n0 0 0\n"), "JASC-PAL"},
+		{"pal", "negative count", []byte("JASC-PAL\n0100\n-1\n"), "invalid color count"},
+		{"pal", "absurd count", []byte("JASC-PAL\n0100\n99999999999\n"), "invalid color count"},
+		{"pal", "missing colors", []byte("JASC-PAL\n0100\n3\n0 0 0\n"), "expected 3 colors"},
+		{"pal", "bad channel", []byte("JASC-PAL\r\n0100\r\n1\r\n0 x 0\r\n"), "line 4"},
+		{"hex", "bad digits", []byte("ff0000\nzz0000\n"), "line 2"},
+		{"png", "not an image", []byte("ff0000\n"), "image"},
+	} {
+		format, _ := paletteFormatByName(test.format, "")
+		_, err := format.Read(test.raw)
+		if err == nil {
+			t.Errorf("%s %s: read succeeded", test.format, test.name)
+		} else if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s %s: got %q, want it to mention %q", test.format, test.name, err, test.message)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Shades spread evenly between these lightnesses, the extremes being left to
+// black and white.
+const (
+	generateDarkest  = 0.3
+	generateLightest = 0.9
+)
+
+// harmonyHue is one ramp of a harmony, offset in degrees from the seed hue.
+type harmonyHue struct {
+	Name   string
+	Offset float64
+}
+
+var harmonies = map[string][]harmonyHue{
+	"complementary": {{"seed", 0}, {"complement", 180}},
+	"analogous":     {{"seed", 0}, {"left", -30}, {"right", 30}},
+	"triadic":       {{"seed", 0}, {"triad-1", 120}, {"triad-2", 240}},
+	"split":         {{"seed", 0}, {"split-1", 150}, {"split-2", 210}},
+	"tetradic":      {{"seed", 0}, {"tetrad-1", 60}, {"tetrad-2", 180}, {"tetrad-3", 240}},
+}
+
+func harmonyNames() []string {
+	names := make([]string, 0, len(harmonies))
+	for name := range harmonies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generateSpaces are the cylindrical spaces ramps are built in: OKLCh, or
+// CIE LCh as HCL.
+var generateSpaces = []string{"oklch", "hcl"}
+
+// lchOf returns the lightness, chroma and hue of c in space.
+func lchOf(c colorful.Color, space string) (l, chroma, hue float64) {
+	if space == "hcl" {
+		hue, chroma, l = c.Hcl()
+		return l, chroma, hue
+	}
+	return okLch(c)
+}
+
+// fromLchInGamut is the color of the given lightness and hue in space, its
+// chroma lowered as far as sRGB needs.
+func fromLchInGamut(l, chroma, hue float64, space string) colorful.Color {
+	if space != "hcl" {
+		return fromOkLchInGamut(l, chroma, hue)
+	}
+	if c := colorful.Hcl(hue, chroma, l); c.IsValid() {
+		return c
+	}
+
+	low, high := 0.0, chroma
+	for i := 0; i < 24; i++ {
+		middle := (low + high) / 2
+		if colorful.Hcl(hue, middle, l).IsValid() {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return colorful.Hcl(hue, low, l).Clamped()
+}
+
+// generatePalette builds a ramp of shades, named like seed-1, for every hue
+// of the harmony. The shade nearest the seed's lightness takes it.
+func generatePalette(seed colorful.Color, harmony string, shades int, space string) (Palette, error) {
+	hues, ok := harmonies[harmony]
+	if !ok {
+		return nil, fmt.Errorf("unknown harmony %q, expected one of %s", harmony, strings.Join(harmonyNames(), ", "))
+	}
+	if space != "oklch" && space != "hcl" {
+		return nil, fmt.Errorf("unknown space %q, expected one of %s", space, strings.Join(generateSpaces, ", "))
+	}
+	if shades < 1 {
+		return nil, fmt.Errorf("shades must be at least 1, got %d", shades)
+	}
+	if _, okChroma, _ := okLch(seed); okChroma < achromaticChroma {
+		return nil, fmt.Errorf("seed %s is a gray, whose hue gives no harmony, pick a more saturated seed", seed.Hex())
+	}
+
+	l, chroma, hue := lchOf(seed, space)
+	lightnesses := make([]float64, shades)
+	seedShade := 0
+	for i := range lightnesses {
+		lightnesses[i] = l
+		if shades > 1 {
+			lightnesses[i] = generateDarkest + (generateLightest-generateDarkest)*float64(i)/float64(shades-1)
+		}
+		if math.Abs(lightnesses[i]-l) < math.Abs(lightnesses[seedShade]-l) {
+			seedShade = i
+		}
+	}
+	lightnesses[seedShade] = l
+
+	var palette Palette
+	for _, harmonyHue := range hues {
+		rampHue := math.Mod(hue+harmonyHue.Offset+360, 360)
+		for i, lightness := range lightnesses {
+			c := fromLchInGamut(lightness, chroma, rampHue, space)
+			if harmonyHue.Offset == 0 && i == seedShade {
+				c = seed
+			}
+			palette = append(palette, PaletteEntry{
+				ColorfulColor: ColorfulColor{c},
+				Name:          fmt.Sprintf("%s-%d", harmonyHue.Name, i+1),
+			})
+		}
+	}
+	return palette, nil
+}
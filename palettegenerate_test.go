@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+func TestGeneratePaletteHoldsSeed(t *testing.T) {
+	for _, space := range generateSpaces {
+		for _, seedHex := range []string{"#88c0d0", "#1a237e", "#ffeb3b"} {
+			seed, _ := colorful.Hex(seedHex)
+			palette, err := generatePalette(seed, "triadic", 5, space)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(palette) != 15 {
+				t.Fatalf("got %d entries, want 15", len(palette))
+			}
+
+			found := false
+			for _, entry := range palette[:5] {
+				found = found || entry.Hex() == seedHex
+			}
+			if !found {
+				t.Errorf("%s %s: the seed ramp does not hold the seed", space, seedHex)
+			}
+			for i := 1; i < 5; i++ {
+				previous, _, _ := lchOf(palette[i-1].Color, space)
+				if l, _, _ := lchOf(palette[i].Color, space); l <= previous {
+					t.Errorf("%s %s: %s is not lighter than %s", space, seedHex, palette[i].Name, palette[i-1].Name)
+				}
+			}
+		}
+	}
+
+	gray, _ := colorful.Hex("#808080")
+	if _, err := generatePalette(gray, "triadic", 5, "oklch"); err == nil {
+		t.Error("generating a palette around a gray succeeded")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	// inspectGrayChroma is the OKLCh chroma below which entries count as
+	// grays, whose hue means nothing.
+	inspectGrayChroma = 0.02
+	// The lightness and hue map has rows of 0.1 lightness and columns of 15
+	// degrees of hue, after a column for grays.
+	inspectLightnessRows = 10
+	inspectHueColumns    = 24
+	inspectGapHueStep    = 30
+)
+
+// paletteInspection describes a palette entry by entry and pair by pair, to
+// judge it before mapping images with it.
+type paletteInspection struct {
+	Palette       Palette
+	MetricName    string
+	NearDuplicate float64
+	Swatches      bool
+}
+
+func (pi paletteInspection) Write(w io.Writer) error {
+	metric, err := colorMetricByName(pi.MetricName)
+	if err != nil {
+		return err
+	}
+	if pi.MetricName == "" {
+		pi.MetricName = defaultColorMetric
+	}
+
+	fmt.Fprintf(w, "%d colors\n\n", len(pi.Palette))
+	if err := pi.writeEntries(w); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	pi.writeDistances(w, metric)
+	fmt.Fprintln(w)
+	if err := pi.writeContrasts(w); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	pi.writeMap(w)
+	return nil
+}
+
+func (pi paletteInspection) label(i int) string {
+	return fmt.Sprintf("%2d %s", i, pi.Palette[i].Label())
+}
+
+func (pi paletteInspection) writeEntries(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, entry := range pi.Palette {
+		l, chroma, hue := okLch(entry.Color)
+		// The hex column follows, unnamed entries are not labeled by it twice.
+		fmt.Fprintf(table, "%2d %s\t%s\toklch(%.1f%% %.3f %.0f)", i, entry.Name, entry.Hex(), l*100, chroma, hue)
+		if pi.Swatches {
+			// Swatches go last, tabwriter would count their escape codes as width.
+			fmt.Fprint(table, "\t"+swatch(entry.ColorfulColor, 6))
+		}
+		fmt.Fprintln(table)
+	}
+	return table.Flush()
+}
+
+// writeDistances prints the lower triangle of the ΔE matrix, marking pairs
+// closer than the near-duplicate threshold, and lists those pairs.
+func (pi paletteInspection) writeDistances(w io.Writer, metric colorMetric) {
+	fmt.Fprintf(w, "ΔE (%s), * marks near-duplicates below %g\n", pi.MetricName, pi.NearDuplicate)
+	fmt.Fprint(w, "   ")
+	for j := 0; j < len(pi.Palette)-1; j++ {
+		fmt.Fprintf(w, "%7d", j)
+	}
+	fmt.Fprintln(w)
+
+	var duplicates []string
+	for i := 1; i < len(pi.Palette); i++ {
+		fmt.Fprintf(w, "%3d", i)
+		for j := 0; j < i; j++ {
+			distance := metric(pi.Palette[i].Color, pi.Palette[j].Color) * 100
+			mark := " "
+			if distance < pi.NearDuplicate {
+				mark = "*"
+				duplicates = append(duplicates, fmt.Sprintf("  %s and %s, ΔE %.1f", strings.TrimSpace(pi.label(j)), strings.TrimSpace(pi.label(i)), distance))
+			}
+			fmt.Fprintf(w, "%6.1f%s", distance, mark)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(duplicates) == 0 {
+		fmt.Fprintln(w, "no near-duplicates")
+		return
+	}
+	fmt.Fprintln(w, "near-duplicates:")
+	for _, duplicate := range duplicates {
+		fmt.Fprintln(w, duplicate)
+	}
+}
+
+// writeContrasts prints the WCAG 2 ratio and the APCA contrast both ways of
+// every pair.
+func (pi paletteInspection) writeContrasts(w io.Writer) error {
+	fmt.Fprintln(w, "Contrast, WCAG 2 ratio and APCA Lc of A on B and B on A")
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "A\tB\tWCAG\tAPCA A/B\tAPCA B/A\t")
+	for i := range pi.Palette {
+		for j := i + 1; j < len(pi.Palette); j++ {
+			a, b := pi.Palette[i].Color, pi.Palette[j].Color
+			fmt.Fprintf(table, "%d\t%d\t%.2f\t%.1f\t%.1f\t\n", i, j, wcagContrast(a, b), apcaContrast(a, b), apcaContrast(b, a))
+		}
+	}
+	return table.Flush()
+}
+
+// writeMap places the entries on a lightness by hue grid and names the bands
+// and hue ranges no entry covers.
+func (pi paletteInspection) writeMap(w io.Writer) {
+	var cells [inspectLightnessRows][inspectHueColumns + 1][]int
+	var lightnessCovered [inspectLightnessRows]bool
+	var hueCovered [360 / inspectGapHueStep]bool
+	for i, entry := range pi.Palette {
+		l, chroma, hue := okLch(entry.Color)
+		row := int(math.Min(math.Max(l, 0)*inspectLightnessRows, inspectLightnessRows-1))
+		column := 0
+		if chroma >= inspectGrayChroma {
+			column = 1 + int(hue/(360/inspectHueColumns))%inspectHueColumns
+			hueCovered[int(hue/inspectGapHueStep)%len(hueCovered)] = true
+		}
+		cells[row][column] = append(cells[row][column], i)
+		lightnessCovered[row] = true
+	}
+
+	fmt.Fprintln(w, "Lightness by hue")
+	fmt.Fprint(w, "   gray  ")
+	for column := 0; column < inspectHueColumns; column += 4 {
+		fmt.Fprintf(w, "%-12d", column*360/inspectHueColumns)
+	}
+	fmt.Fprintln(w)
+
+	for row := inspectLightnessRows - 1; row >= 0; row-- {
+		fmt.Fprintf(w, "%.1f ", float64(row)/inspectLightnessRows)
+		for column, entries := range cells[row] {
+			fmt.Fprint(w, pi.mapCell(entries))
+			if column == 0 {
+				fmt.Fprint(w, " ")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	var gaps []string
+	for row, covered := range lightnessCovered {
+		if !covered {
+			gaps = append(gaps, fmt.Sprintf("lightness %.1f-%.1f", float64(row)/inspectLightnessRows, float64(row+1)/inspectLightnessRows))
+		}
+	}
+	for sector, covered := range hueCovered {
+		if !covered {
+			gaps = append(gaps, fmt.Sprintf("hue %d-%d", sector*inspectGapHueStep, (sector+1)*inspectGapHueStep))
+		}
+	}
+	if len(gaps) == 0 {
+		fmt.Fprintln(w, "no gaps")
+		return
+	}
+	fmt.Fprintln(w, "gaps: "+strings.Join(gaps, ", "))
+}
+
+// mapCell renders a map cell three characters wide, with the index of a
+// single entry or the count of several.
+func (pi paletteInspection) mapCell(entries []int) string {
+	if len(entries) == 0 {
+		return " · "
+	}
+	text := fmt.Sprintf("%2d ", entries[0])
+	if len(entries) > 1 {
+		text = fmt.Sprintf("+%-2d", len(entries))
+	}
+	if !pi.Swatches {
+		return text
+	}
+
+	c := pi.Palette[entries[0]].Color.Clamped()
+	r, g, b := c.RGB255()
+	foreground := "30"
+	if wcagContrast(c, colorful.Color{}) < 4.5 {
+		foreground = "97"
+	}
+	return fmt.Sprintf("\x1b[%s;48;2;%d;%d;%dm%s\x1b[0m", foreground, r, g, b, text)
+}
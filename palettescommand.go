@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+)
+
+var palettesCommand = &cli.Command{
+	Name:      "palettes",
+	Usage:     "List the built-in and library palettes, or print the colors of the named ones.\nExample usage: img2theme palettes catppuccin-mocha",
+	ArgsUsage: "[NAME...]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "color",
+			Usage: "print color swatches: auto, always or never",
+			Value: "auto",
+		},
+	},
+	Action: palettesAction,
+}
+
+// useSwatches decides whether to print truecolor swatches. In auto mode they
+// are printed to terminals unless NO_COLOR is set.
+func useSwatches(mode string, output *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		info, err := output.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+
+	return false, fmt.Errorf("unknown color mode %q, expected auto, always or never", mode)
+}
+
+// swatch renders a block of the color c with a 24-bit ANSI background.
+func swatch(c ColorfulColor, width int) string {
+	r, g, b := c.Clamped().RGB255()
+	return fmt.Sprintf("\x1b[48;2;%d;%d;%dm%s\x1b[0m", r, g, b, strings.Repeat(" ", width))
+}
+
+func writePaletteSwatches(w io.Writer, palette Palette) {
+	for _, entry := range palette {
+		fmt.Fprint(w, swatch(entry.ColorfulColor, 2))
+	}
+}
+
+func palettesAction(c *cli.Context) error {
+	swatches, err := useSwatches(c.String("color"), os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() > 0 {
+		for i, name := range c.Args().Slice() {
+			palette, err := loadNamedPalette(name)
+			if err != nil {
+				return err
+			}
+
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", name)
+			table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, entry := range palette {
+				// Swatches go last, tabwriter would count their escape codes as width.
+				fmt.Fprintf(table, "  %s\t%s\t", entry.Label(), entry.Hex())
+				if swatches {
+					fmt.Fprint(table, swatch(entry.ColorfulColor, 4))
+				}
+				fmt.Fprintln(table)
+			}
+			if err := table.Flush(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	sources := map[string]string{}
+	for _, name := range catalogPaletteNames() {
+		sources[name] = "built-in"
+	}
+	dir, err := palettesDir()
+	if err != nil {
+		return err
+	}
+	library, err := listLibrary(dir, paletteFileExtensions())
+	if err != nil {
+		return err
+	}
+	for _, entry := range library {
+		sources[entry.Name] = entry.Path
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tCOLORS\tSOURCE\t")
+	for _, name := range names {
+		palette, err := loadNamedPalette(name)
+		if err != nil {
+			fmt.Fprintf(table, "%s\t-\t%s\t%v\n", name, sources[name], err)
+			continue
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%s\t", name, len(palette), sources[name])
+		if swatches {
+			writePaletteSwatches(table, palette)
+		}
+		fmt.Fprintln(table)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	themeForeground = 16 + iota
+	themeBackground
+	themeCursor
+	themeSlots
+)
+
+// terminalColorNames names the slots of a terminalTheme.
+var terminalColorNames = [themeSlots]string{
+	"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white",
+	"bright-black", "bright-red", "bright-green", "bright-yellow",
+	"bright-blue", "bright-magenta", "bright-cyan", "bright-white",
+	"foreground", "background", "cursor",
+}
+
+// terminalTheme collects the colors of a terminal theme by slot: the ANSI
+// colors 0 to 15, then foreground, background and cursor.
+type terminalTheme [themeSlots]*colorful.Color
+
+func (t *terminalTheme) set(slot int, raw string) error {
+	c, err := parseTerminalColor(raw)
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", terminalColorNames[slot], raw, err)
+	}
+	t[slot] = &c
+	return nil
+}
+
+// palette names every color the theme sets after its slot.
+func (t terminalTheme) palette() (Palette, error) {
+	var palette Palette
+	for slot, c := range t {
+		if c != nil {
+			palette = append(palette, PaletteEntry{ColorfulColor: ColorfulColor{*c}, Name: terminalColorNames[slot]})
+		}
+	}
+
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("no terminal colors found")
+	}
+	return palette, nil
+}
+
+// parseTerminalColor reads the color notations of terminal configs on top of
+// those parseColor knows: bare hex digits and X11 rgb:r/g/b.
+func parseTerminalColor(raw string) (colorful.Color, error) {
+	value := strings.Trim(strings.TrimSpace(raw), `"'`)
+
+	if strings.HasPrefix(value, "rgb:") {
+		channels := strings.Split(value[len("rgb:"):], "/")
+		if len(channels) != 3 {
+			return colorful.Color{}, fmt.Errorf("expected rgb:r/g/b")
+		}
+		var rgb [3]float64
+		for i, channel := range channels {
+			level, err := strconv.ParseUint(channel, 16, 16)
+			if err != nil || len(channel) == 0 || len(channel) > 4 {
+				return colorful.Color{}, fmt.Errorf("expected 1 to 4 hex digits per channel")
+			}
+			rgb[i] = float64(level) / float64(uint64(1)<<(4*len(channel))-1)
+		}
+		return colorful.Color{R: rgb[0], G: rgb[1], B: rgb[2]}, nil
+	}
+
+	if len(value) == 6 && !strings.ContainsAny(value, "#(") {
+		if c, err := parseHexDigits(value); err == nil {
+			return c, nil
+		}
+	}
+	return parseColorString(value)
+}
+
+// readXresourcesPalette reads color0 to color15, foreground, background and
+// cursorColor, expanding #define macros.
+func readXresourcesPalette(raw []byte) (Palette, error) {
+	var theme terminalTheme
+	defines := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 3 && fields[0] == "#define" {
+				defines[fields[1]] = fields[2]
+			}
+			continue
+		}
+
+		resource, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if defined, ok := defines[value]; ok {
+			value = defined
+		}
+
+		name := resource[strings.LastIndexAny(resource, ".*")+1:]
+		slot, ok := terminalSlotOf(strings.TrimSpace(name), "color", map[string]int{
+			"foreground":  themeForeground,
+			"background":  themeBackground,
+			"cursorColor": themeCursor,
+		})
+		if !ok {
+			continue
+		}
+		if err := theme.set(slot, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return theme.palette()
+}
+
+// terminalSlotOf finds the slot of a key that is either prefix followed by an
+// ANSI color number or one of named.
+func terminalSlotOf(key, prefix string, named map[string]int) (int, bool) {
+	if slot, ok := named[key]; ok {
+		return slot, true
+	}
+	if !strings.HasPrefix(key, prefix) {
+		return 0, false
+	}
+	slot, err := strconv.Atoi(key[len(prefix):])
+	if err != nil || slot < 0 || slot > 15 {
+		return 0, false
+	}
+	return slot, true
+}
+
+// readKittyPalette reads the color0 to color15, foreground, background and
+// cursor options of a kitty.conf or kitty theme.
+func readKittyPalette(raw []byte) (Palette, error) {
+	var theme terminalTheme
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		slot, ok := terminalSlotOf(fields[0], "color", map[string]int{
+			"foreground": themeForeground,
+			"background": themeBackground,
+			"cursor":     themeCursor,
+		})
+		if !ok || fields[1] == "none" {
+			continue
+		}
+		if err := theme.set(slot, fields[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return theme.palette()
+}
+
+// readFootPalette reads the [colors] section of a foot.ini, and the cursor
+// color from either [colors] or [cursor], given as "TEXT CURSOR".
+func readFootPalette(raw []byte) (Palette, error) {
+	var theme terminalTheme
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		slot := -1
+		switch {
+		case section == "colors" || section == "colors-dark":
+			switch {
+			case key == "foreground":
+				slot = themeForeground
+			case key == "background":
+				slot = themeBackground
+			case key == "cursor":
+				slot = themeCursor
+			default:
+				if regular, ok := terminalSlotOf(key, "regular", nil); ok && regular < 8 {
+					slot = regular
+				} else if bright, ok := terminalSlotOf(key, "bright", nil); ok && bright < 8 {
+					slot = bright + 8
+				}
+			}
+		case section == "cursor" && key == "color":
+			slot = themeCursor
+		}
+		if slot < 0 {
+			continue
+		}
+
+		if colors := strings.Fields(value); slot == themeCursor && len(colors) > 0 {
+			value = colors[len(colors)-1]
+		}
+		if err := theme.set(slot, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return theme.palette()
+}
+
+// readTomlPalette reads an alacritty or a WezTerm theme, told apart by whether
+// colors.ansi is set.
+func readTomlPalette(raw []byte) (Palette, error) {
+	values, err := parseToml(string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := values["colors.ansi"]; ok {
+		return weztermTheme(values)
+	}
+	return alacrittyTheme(values)
+}
+
+var alacrittyColorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// alacrittyTheme reads the colors of an alacritty config flattened to dotted
+// keys, from either its TOML or its older YAML form.
+func alacrittyTheme(values map[string]interface{}) (Palette, error) {
+	var keys [themeSlots]string
+	for i, name := range alacrittyColorNames {
+		keys[i] = "colors.normal." + name
+		keys[i+8] = "colors.bright." + name
+	}
+	keys[themeForeground] = "colors.primary.foreground"
+	keys[themeBackground] = "colors.primary.background"
+	keys[themeCursor] = "colors.cursor.cursor"
+
+	var theme terminalTheme
+	for slot, key := range keys {
+		value, ok := values[key].(string)
+		// CellForeground and CellBackground follow the cell under the cursor.
+		if !ok || strings.HasPrefix(value, "Cell") {
+			continue
+		}
+		if err := theme.set(slot, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return theme.palette()
+}
+
+func weztermTheme(values map[string]interface{}) (Palette, error) {
+	var theme terminalTheme
+	keys := map[int]string{
+		themeForeground: "colors.foreground",
+		themeBackground: "colors.background",
+		themeCursor:     "colors.cursor_bg",
+	}
+	for slot := themeForeground; slot < themeSlots; slot++ {
+		key := keys[slot]
+		if value, ok := values[key].(string); ok {
+			if err := theme.set(slot, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	for _, key := range []string{"colors.ansi", "colors.brights"} {
+		offset := 0
+		if key == "colors.brights" {
+			offset = 8
+		}
+		colors, _ := values[key].([]interface{})
+		if len(colors) > 8 {
+			return nil, fmt.Errorf("%s: expected 8 colors, got %d", key, len(colors))
+		}
+		for i, value := range colors {
+			if err := theme.set(offset+i, fmt.Sprint(value)); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	return theme.palette()
+}
+
+// base16Slots maps the ANSI colors to scheme colors the way base16-shell
+// does. Base24 schemes have bright colors of their own.
+var (
+	base16Slots = [themeSlots]string{
+		"base00", "base08", "base0B", "base0A", "base0D", "base0E", "base0C", "base05",
+		"base03", "base08", "base0B", "base0A", "base0D", "base0E", "base0C", "base07",
+		"base05", "base00", "base05",
+	}
+	base24Slots = [themeSlots]string{
+		"base00", "base08", "base0B", "base0A", "base0D", "base0E", "base0C", "base05",
+		"base02", "base12", "base14", "base13", "base16", "base17", "base15", "base07",
+		"base05", "base00", "base05",
+	}
+)
+
+// base16Theme reads a base16 or base24 scheme, with its colors at the top
+// level as in the original format or under palette as in tinted-theming's.
+func base16Theme(values map[string]interface{}) (Palette, error) {
+	prefix := ""
+	if _, ok := values["palette.base00"]; ok {
+		prefix = "palette."
+	}
+
+	slots := base16Slots
+	if _, ok := values[prefix+"base12"]; ok {
+		slots = base24Slots
+	}
+
+	var theme terminalTheme
+	for slot, key := range slots {
+		value, ok := values[prefix+key]
+		if !ok {
+			// Scheme keys are written both as base0B and base0b.
+			value, ok = values[prefix+strings.ToLower(key)]
+		}
+		if !ok {
+			return nil, fmt.Errorf("missing %s", key)
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a color", key)
+		}
+		if err := theme.set(slot, text); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return theme.palette()
+}
+
+// readYamlThemePalette reads a YAML mapping as a base16 or base24 scheme, or
+// as an alacritty config.
+func readYamlThemePalette(raw []byte) (Palette, error) {
+	document, err := parseYamlDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	if document != nil {
+		flattenYamlThemeValues("", document, values)
+	}
+
+	if _, ok := values["colors.primary.background"]; ok {
+		return alacrittyTheme(values)
+	}
+	if _, ok := values["colors.normal.black"]; ok {
+		return alacrittyTheme(values)
+	}
+	return base16Theme(values)
+}
+
+// flattenYamlThemeValues stores the scalars of nested mappings under their
+// dotted keys as written, so that 000000 or 0x1d2021 are not read as numbers.
+func flattenYamlThemeValues(prefix string, node *yaml.Node, values map[string]interface{}) {
+	node = resolveYamlAlias(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		pairs, _ := yamlMappingPairs(node)
+		for _, pair := range pairs {
+			flattenYamlThemeValues(prefix+pair[0].Value+".", pair[1], values)
+		}
+	case yaml.SequenceNode:
+		items := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			items[i] = resolveYamlAlias(item).Value
+		}
+		values[strings.TrimSuffix(prefix, ".")] = items
+	default:
+		values[strings.TrimSuffix(prefix, ".")] = node.Value
+	}
+}
+
+// flattenThemeValues stores the leaves of nested mappings under their dotted
+// keys.
+func flattenThemeValues(prefix string, value interface{}, values map[string]interface{}) {
+	if table, ok := value.(map[string]interface{}); ok {
+		for key, nested := range table {
+			flattenThemeValues(prefix+key+".", nested, values)
+		}
+		return
+	}
+	values[strings.TrimSuffix(prefix, ".")] = value
+}
+
+var windowsTerminalColorNames = []string{"black", "red", "green", "yellow", "blue", "purple", "cyan", "white"}
+
+// readWindowsTerminalPalette reads a Windows Terminal color scheme, or the
+// first of the schemes in a settings.json, which may have comments.
+func readWindowsTerminalPalette(raw []byte) (Palette, error) {
+	var scheme map[string]interface{}
+	if err := json.Unmarshal(stripJsonComments(raw), &scheme); err != nil {
+		return nil, err
+	}
+
+	if schemes, ok := scheme["schemes"].([]interface{}); ok {
+		if len(schemes) == 0 {
+			return nil, fmt.Errorf("schemes is empty")
+		}
+		first, ok := schemes[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("schemes[0] is not a color scheme")
+		}
+		scheme = first
+	}
+
+	var keys [themeSlots]string
+	for i, name := range windowsTerminalColorNames {
+		keys[i] = name
+		keys[i+8] = "bright" + strings.ToUpper(name[:1]) + name[1:]
+	}
+	keys[themeForeground] = "foreground"
+	keys[themeBackground] = "background"
+	keys[themeCursor] = "cursorColor"
+
+	var theme terminalTheme
+	for slot, key := range keys {
+		if value, ok := scheme[key].(string); ok {
+			if err := theme.set(slot, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	return theme.palette()
+}
+
+// readItermPalette reads an iTerm2 .itermcolors property list. Components
+// are taken as sRGB whatever color space they were saved in.
+func readItermPalette(raw []byte) (Palette, error) {
+	document, err := parsePlist(raw)
+	if err != nil {
+		return nil, err
+	}
+	colors, ok := document.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a dictionary of colors")
+	}
+
+	var keys [themeSlots]string
+	for i := 0; i < 16; i++ {
+		keys[i] = fmt.Sprintf("Ansi %d Color", i)
+	}
+	keys[themeForeground] = "Foreground Color"
+	keys[themeBackground] = "Background Color"
+	keys[themeCursor] = "Cursor Color"
+
+	var theme terminalTheme
+	for slot, key := range keys {
+		components, ok := colors[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var rgb [3]float64
+		for i, name := range []string{"Red Component", "Green Component", "Blue Component"} {
+			component, ok := components[name].(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s: missing %s", key, name)
+			}
+			rgb[i] = component
+		}
+		c := colorful.Color{R: rgb[0], G: rgb[1], B: rgb[2]}.Clamped()
+		theme[slot] = &c
+	}
+
+	return theme.palette()
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTerminalThemeReaders(t *testing.T) {
+	for _, test := range []struct {
+		name, format, raw string
+		want              map[string]string
+	}{
+		{
+			name:   "alacritty toml",
+			format: "toml",
+			raw: `# Colors (Gruvbox dark)
+
+[colors.primary]
+# hard contrast background = = '#1d2021'
+background = '#282828'
+foreground = '#ebdbb2'
+
+[colors.cursor]
+text = "CellBackground"
+cursor = "CellForeground"
+
+[colors.normal]
+black   = '#282828'
+red     = '#cc241d'
+green   = '#98971a'
+yellow  = '#d79921'
+blue    = '#458588'
+magenta = '#b16286'
+cyan    = '#689d6a'
+white   = '#a89984'
+
+[colors.bright]
+black   = '#928374'
+red     = '#fb4934'
+green   = '#b8bb26'
+yellow  = '#fabd2f'
+blue    = '#83a598'
+magenta = '#d3869b'
+cyan    = '#8ec07c'
+white   = '#ebdbb2'
+`,
+			want: map[string]string{"background": "#282828", "red": "#cc241d", "bright-white": "#ebdbb2", "cursor": ""},
+		},
+		{
+			name:   "alacritty toml with inline tables",
+			format: "toml",
+			raw: `[colors]
+primary = { background = "0x1e1e2e", foreground = "0xcdd6f4" }
+normal = { black = "0x45475a", red = "0xf38ba8" }
+`,
+			want: map[string]string{"background": "#1e1e2e", "foreground": "#cdd6f4", "red": "#f38ba8"},
+		},
+		{
+			name:   "alacritty yaml",
+			format: "yaml",
+			raw: `colors:
+  primary:
+    background: '0x002b36'
+    foreground: 0x839496
+  normal:
+    black:   0x073642
+    red:     0xdc322f
+`,
+			want: map[string]string{"background": "#002b36", "foreground": "#839496", "black": "#073642", "red": "#dc322f"},
+		},
+		{
+			name:   "wezterm",
+			format: "toml",
+			raw: `[colors]
+ansi = [
+    "#0c0c0c",
+    "#c50f1f",
+    "#13a10e",
+    "#c19c00",
+    "#0037da",
+    "#881798",
+    "#3a96dd",
+    "#cccccc",
+]
+brights = ["#767676", "#e74856", "#16c60c", "#f9f1a5", "#3b78ff", "#b4009e", "#61d6d6", "#f2f2f2"]
+background = "#0c0c0c"
+cursor_bg = "#ffffff"
+cursor_border = "#ffffff"
+foreground = "#cccccc"
+selection_bg = "#ffffff"
+
+[metadata]
+name = "Campbell"
+origin_url = "https://github.com/mbadolato/iTerm2-Color-Schemes"
+`,
+			want: map[string]string{"red": "#c50f1f", "bright-white": "#f2f2f2", "cursor": "#ffffff", "background": "#0c0c0c"},
+		},
+		{
+			name:   "kitty",
+			format: "kitty",
+			raw: `# vim:ft=kitty
+## name: Tokyo Night
+foreground #c0caf5
+background #1a1b26
+selection_foreground none
+cursor #c0caf5
+url_color #73daca
+
+# black
+color0 #15161e
+color8 #414868
+
+# red
+color1 #f7768e
+color9 #f7768e
+`,
+			want: map[string]string{"foreground": "#c0caf5", "background": "#1a1b26", "black": "#15161e", "bright-black": "#414868", "bright-red": "#f7768e"},
+		},
+		{
+			name:   "foot",
+			format: "foot",
+			raw: `# -*- conf -*-
+[cursor]
+color=282828 ebdbb2
+
+[colors]
+background=282828
+foreground=ebdbb2
+regular0=282828
+regular1=cc241d
+bright0=928374
+bright7=ebdbb2
+`,
+			want: map[string]string{"cursor": "#ebdbb2", "background": "#282828", "red": "#cc241d", "bright-black": "#928374"},
+		},
+		{
+			name:   "xresources",
+			format: "xresources",
+			raw: `! Dracula Xresources palette
+#define BG #282a36
+#define FG #f8f8f2
+*.foreground: FG
+*.background: BG
+*.cursorColor: FG
+URxvt*color0:  #000000
+*.color8:      #4d4d4d
+XTerm.vt100.color1: rgb:ff/55/55
+*color9: #ff6e67
+`,
+			want: map[string]string{"foreground": "#f8f8f2", "background": "#282a36", "black": "#000000", "red": "#ff5555", "bright-red": "#ff6e67"},
+		},
+		{
+			name:   "windows terminal settings with comments",
+			format: "windows-terminal",
+			raw: `// This file was initially generated by Windows Terminal 1.18
+// It should still be usable in newer versions, but newer versions might have additional
+// settings, help text, or changes that you will not see unless you clear this file
+// and let us generate a new one for you.
+
+// To view the default settings, hold "alt" while clicking on the "Settings" button.
+// For documentation on these settings, see: https://aka.ms/terminal-documentation
+{
+    "$help": "https://aka.ms/terminal-documentation",
+    "$schema": "https://aka.ms/terminal-profiles-schema",
+    /* Add custom color schemes to this array. */
+    "schemes": [
+        {
+            "name": "One Half Dark",
+            "background": "#282C34", // the editor background
+            "black": "#282C34",
+            "blue": "#61AFEF",
+            "brightBlack": "#5A6374",
+            "brightRed": "#E06C75",
+            "cursorColor": "#FFFFFF",
+            "foreground": "#DCDFE4",
+            "purple": "#C678DD",
+            "red": "#E06C75",
+        },
+    ],
+}
+`,
+			want: map[string]string{"background": "#282c34", "blue": "#61afef", "magenta": "#c678dd", "bright-black": "#5a6374", "cursor": "#ffffff"},
+		},
+		{
+			name:   "iterm2",
+			format: "iterm2",
+			raw: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Ansi 0 Color</key>
+	<dict>
+		<key>Alpha Component</key>
+		<real>1</real>
+		<key>Blue Component</key>
+		<real>0.0</real>
+		<key>Color Space</key>
+		<string>sRGB</string>
+		<key>Green Component</key>
+		<real>0.0</real>
+		<key>Red Component</key>
+		<real>0.0</real>
+	</dict>
+	<key>Ansi 1 Color</key>
+	<dict>
+		<key>Blue Component</key>
+		<real>0.21176470588235294</real>
+		<key>Green Component</key>
+		<real>0.21176470588235294</real>
+		<key>Red Component</key>
+		<real>0.93333333333333335</real>
+	</dict>
+	<key>Background Color</key>
+	<dict>
+		<key>Blue Component</key>
+		<integer>1</integer>
+		<key>Green Component</key>
+		<integer>1</integer>
+		<key>Red Component</key>
+		<integer>1</integer>
+	</dict>
+	<key>Selected Text Color</key>
+	<dict>
+		<key>Blue Component</key>
+		<real>0.0</real>
+		<key>Green Component</key>
+		<real>0.0</real>
+		<key>Red Component</key>
+		<real>0.0</real>
+	</dict>
+</dict>
+</plist>
+`,
+			want: map[string]string{"black": "#000000", "red": "#ee3636", "background": "#ffffff"},
+		},
+		{
+			name:   "base16 with digit only values",
+			format: "yaml",
+			raw: `scheme: "Grayscale Dark"
+author: "Alexandre Gavioli (https://github.com/Alexx2/)"
+base00: "101010"
+base01: 252525
+base02: 464646
+base03: 000000
+base04: 525252
+base05: ababab
+base06: e3e3e3
+base07: f7f7f7
+base08: 7c7c7c
+base09: 999999
+base0A: a0a0a0
+base0B: 8e8e8e
+base0C: 868686
+base0D: 686868
+base0E: 747474
+base0F: 5e5e5e
+`,
+			want: map[string]string{"background": "#101010", "bright-black": "#000000", "red": "#7c7c7c", "blue": "#686868", "bright-white": "#f7f7f7"},
+		},
+		{
+			name:   "base24 in tinted-theming form",
+			format: "yaml",
+			raw: `system: "base24"
+name: "One Dark"
+variant: "dark"
+palette:
+  base00: "#282c34"
+  base01: "#3f4451"
+  base02: "#4f5666"
+  base03: "#545862"
+  base04: "#9196a1"
+  base05: "#abb2bf"
+  base06: "#e6e6e6"
+  base07: "#ffffff"
+  base08: "#e06c75"
+  base09: "#d19a66"
+  base0A: "#e5c07b"
+  base0B: "#98c379"
+  base0C: "#56b6c2"
+  base0D: "#61afef"
+  base0E: "#c678dd"
+  base0F: "#be5046"
+  base10: "#21252b"
+  base11: "#181a1f"
+  base12: "#ff7b86"
+  base13: "#efb074"
+  base14: "#b1e18b"
+  base15: "#63d4e0"
+  base16: "#67cdff"
+  base17: "#e48bff"
+`,
+			want: map[string]string{"bright-black": "#4f5666", "bright-red": "#ff7b86", "bright-blue": "#67cdff", "white": "#abb2bf"},
+		},
+	} {
+		format, err := paletteFormatByName(test.format, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		palette, err := format.Read([]byte(test.raw))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		got := map[string]string{}
+		for _, entry := range palette {
+			got[entry.Name] = entry.Hex()
+		}
+		for name, hex := range test.want {
+			if got[name] != hex {
+				t.Errorf("%s: got %s %q, want %q", test.name, name, got[name], hex)
+			}
+		}
+	}
+}
+
+func TestTerminalThemeReadersRejectMalformedFiles(t *testing.T) {
+	for _, test := range []struct {
+		name, format, raw, message string
+	}{
+		{"unterminated toml string", "toml", "[colors.primary]\nbackground = \"#000000\nforeground = \"#ffffff\"\n", "line 2"},
+		{"toml without a value", "toml", "[colors.primary]\n\nbackground =\n", "line 3"},
+		{"missing base16 color", "yaml", "base00: '000000'\n", "missing base08"},
+		{"base16 color as a list", "yaml", "base00: [0, 0, 0]\n", "base00"},
+		{"unterminated json comment", "windows-terminal", "{\"red\": \"#ff0000\" /* scheme\n}", "invalid character '/'"},
+		{"kitty color out of range", "kitty", "color1 #ff00gg\n", "line 1"},
+	} {
+		format, _ := paletteFormatByName(test.format, "")
+		_, err := format.Read([]byte(test.raw))
+		if err == nil {
+			t.Errorf("%s: read succeeded", test.name)
+		} else if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: got %q, want it to mention %q", test.name, err, test.message)
+		}
+	}
+}
+
+func TestStripJsonComments(t *testing.T) {
+	raw := `{"url": "http://a/*b*/", // comment "x"
+"list": [1, 2, ], /* multi
+line */ "s": "a,]"}`
+	want := `{"url": "http://a/*b*/", "list": [1, 2 ], "s": "a,]"}`
+	got := stripJsonComments([]byte(raw))
+	if len(got) != len(raw) || strings.Join(strings.Fields(string(got)), " ") != want {
+		t.Errorf("got\n%s\nwant the same offsets and\n%s", got, want)
+	}
+}
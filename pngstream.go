@@ -0,0 +1,474 @@
+package main
+
+import (
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	pngSignature = "\x89PNG\r\n\x1a\n"
+	// pngHeaderSize covers the signature and the IHDR chunk, which must come
+	// first and tells whether the image is interlaced.
+	pngHeaderSize = 33
+	// streamedPNGOverhead is about what the inflater and the chunk reader
+	// take besides the rows.
+	streamedPNGOverhead = 64 << 10
+
+	pngColorGray      = 0
+	pngColorTruecolor = 2
+	pngColorIndexed   = 3
+	pngColorGrayAlpha = 4
+	pngColorRGBA      = 6
+)
+
+// pngStreamable tells from the header whether newStreamedPNG can decode a
+// file, which it can for any PNG but an interlaced one.
+func pngStreamable(header []byte) bool {
+	return len(header) >= pngHeaderSize && string(header[:8]) == pngSignature &&
+		string(header[12:16]) == "IHDR" && header[28] == 0
+}
+
+// streamedPNG decodes a non-interlaced PNG band by band, top to bottom,
+// keeping decoding errors for Err.
+type streamedPNG struct {
+	r                 io.Reader
+	width, height     int
+	depth, colorType  int
+	palette           []color.NRGBA
+	transparent       []byte
+	pixels            io.Reader
+	current, previous []byte
+	bitsPerPixel      int
+	window            image.Image
+	next              int
+	err               error
+}
+
+func newStreamedPNG(r io.Reader) (*streamedPNG, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || string(signature) != pngSignature {
+		return nil, errors.New("png: missing signature")
+	}
+
+	s := &streamedPNG{r: r}
+	for first := true; s.pixels == nil; first = false {
+		length, chunkType, err := readPNGChunkHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if first != (chunkType == "IHDR") {
+			return nil, errors.New("png: IHDR is not the first chunk")
+		}
+
+		switch chunkType {
+		case "IHDR", "PLTE", "tRNS":
+			data, err := readPNGChunk(r, chunkType, length)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.parseChunk(chunkType, data); err != nil {
+				return nil, err
+			}
+		case "IDAT":
+			if s.colorType == pngColorIndexed && s.palette == nil {
+				return nil, errors.New("png: indexed image without a PLTE chunk")
+			}
+			pixels, err := zlib.NewReader(&pngDataReader{r: r, remaining: length, crc: newPNGChunkCRC(chunkType)})
+			if err != nil {
+				return nil, fmt.Errorf("png: %w", err)
+			}
+			s.pixels = pixels
+		case "IEND":
+			return nil, errors.New("png: no image data")
+		default:
+			if err := skipPNGChunk(r, chunkType, length); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rowBytes := (int64(s.width)*int64(s.bitsPerPixel) + 7) / 8
+	if rowBytes+1 > int64(^uint(0)>>1) {
+		return nil, errors.New("png: rows too wide")
+	}
+	s.current = make([]byte, rowBytes+1)
+	s.previous = make([]byte, rowBytes+1)
+	return s, nil
+}
+
+func (s *streamedPNG) parseChunk(chunkType string, data []byte) error {
+	switch chunkType {
+	case "IHDR":
+		if len(data) != 13 {
+			return errors.New("png: bad IHDR length")
+		}
+		width, height := binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint32(data[4:8])
+		if width == 0 || height == 0 || width > 1<<31-1 || height > 1<<31-1 {
+			return fmt.Errorf("png: bad dimensions %dx%d", width, height)
+		}
+		if data[10] != 0 || data[11] != 0 {
+			return errors.New("png: unknown compression or filter method")
+		}
+		if data[12] != 0 {
+			return errors.New("png: interlaced images cannot be streamed")
+		}
+		s.width, s.height = int(width), int(height)
+		s.depth, s.colorType = int(data[8]), int(data[9])
+
+		channels := map[int]int{pngColorGray: 1, pngColorTruecolor: 3, pngColorIndexed: 1, pngColorGrayAlpha: 2, pngColorRGBA: 4}[s.colorType]
+		valid := map[int][]int{
+			pngColorGray:      {1, 2, 4, 8, 16},
+			pngColorTruecolor: {8, 16},
+			pngColorIndexed:   {1, 2, 4, 8},
+			pngColorGrayAlpha: {8, 16},
+			pngColorRGBA:      {8, 16},
+		}[s.colorType]
+		for _, depth := range valid {
+			if depth == s.depth {
+				s.bitsPerPixel = channels * s.depth
+			}
+		}
+		if s.bitsPerPixel == 0 {
+			return fmt.Errorf("png: bit depth %d is invalid for color type %d", s.depth, s.colorType)
+		}
+	case "PLTE":
+		if len(data)%3 != 0 || len(data) == 0 || len(data) > 256*3 {
+			return errors.New("png: bad PLTE length")
+		}
+		s.palette = make([]color.NRGBA, len(data)/3)
+		for i := range s.palette {
+			s.palette[i] = color.NRGBA{data[3*i], data[3*i+1], data[3*i+2], 0xff}
+		}
+	case "tRNS":
+		switch s.colorType {
+		case pngColorIndexed:
+			if len(data) > len(s.palette) {
+				return errors.New("png: tRNS has more entries than PLTE")
+			}
+			for i, alpha := range data {
+				s.palette[i].A = alpha
+			}
+		case pngColorGray, pngColorTruecolor:
+			if len(data) != 2*map[int]int{pngColorGray: 1, pngColorTruecolor: 3}[s.colorType] {
+				return errors.New("png: bad tRNS length")
+			}
+			s.transparent = data
+		}
+	}
+	return nil
+}
+
+func (s *streamedPNG) ColorModel() color.Model {
+	if s.depth == 16 {
+		return color.NRGBA64Model
+	}
+	return color.NRGBAModel
+}
+
+func (s *streamedPNG) Bounds() image.Rectangle {
+	return image.Rect(0, 0, s.width, s.height)
+}
+
+func (s *streamedPNG) At(x, y int) color.Color {
+	if s.window == nil || !(image.Point{x, y}.In(s.window.Bounds())) {
+		return color.NRGBA{}
+	}
+	return s.window.At(x, y)
+}
+
+func (s *streamedPNG) Err() error {
+	return s.err
+}
+
+// windowBytesPerRow is what every loaded row takes.
+func (s *streamedPNG) windowBytesPerRow() int64 {
+	if s.depth == 16 {
+		return int64(s.width) * 8
+	}
+	return int64(s.width) * 4
+}
+
+// decoderBytes is what decoding takes besides the loaded rows.
+func (s *streamedPNG) decoderBytes() int64 {
+	return int64(len(s.current)+len(s.previous)) + streamedPNGOverhead
+}
+
+// load decodes up to row bottom and keeps the rows from top on, dropping the
+// previous band.
+func (s *streamedPNG) load(top, bottom int) {
+	rect := image.Rect(0, top, s.width, bottom).Intersect(s.Bounds())
+	if s.err != nil || (s.window != nil && rect.In(s.window.Bounds())) {
+		return
+	}
+	if rect.Min.Y < s.next {
+		s.err = fmt.Errorf("png: rows %d to %d were requested after streaming past them", rect.Min.Y, rect.Max.Y)
+		return
+	}
+
+	s.window = s.newWindow(rect)
+	for ; s.next < rect.Max.Y; s.next++ {
+		row, err := s.decodeRow()
+		if err != nil {
+			s.err = err
+			return
+		}
+		if s.next >= rect.Min.Y {
+			s.setRow(s.next, row)
+		}
+	}
+}
+
+// newWindow reuses the pixels of the previous band when they are large enough.
+func (s *streamedPNG) newWindow(rect image.Rectangle) image.Image {
+	switch window := s.window.(type) {
+	case *image.NRGBA:
+		if size := rect.Dx() * rect.Dy() * 4; cap(window.Pix) >= size {
+			return &image.NRGBA{Pix: window.Pix[:size], Stride: rect.Dx() * 4, Rect: rect}
+		}
+	case *image.NRGBA64:
+		if size := rect.Dx() * rect.Dy() * 8; cap(window.Pix) >= size {
+			return &image.NRGBA64{Pix: window.Pix[:size], Stride: rect.Dx() * 8, Rect: rect}
+		}
+	}
+
+	if s.depth == 16 {
+		return image.NewNRGBA64(rect)
+	}
+	return image.NewNRGBA(rect)
+}
+
+// decodeRow inflates and unfilters the next row, returning it without the
+// filter byte.
+func (s *streamedPNG) decodeRow() ([]byte, error) {
+	if _, err := io.ReadFull(s.pixels, s.current); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("png: image data ends at row %d of %d", s.next, s.height)
+		}
+		return nil, fmt.Errorf("png: %w", err)
+	}
+
+	bytesPerPixel := (s.bitsPerPixel + 7) / 8
+	filter, row, previous := s.current[0], s.current[1:], s.previous[1:]
+	switch filter {
+	case 0:
+	case 1:
+		for i := bytesPerPixel; i < len(row); i++ {
+			row[i] += row[i-bytesPerPixel]
+		}
+	case 2:
+		for i := range row {
+			row[i] += previous[i]
+		}
+	case 3:
+		for i := range row {
+			left := 0
+			if i >= bytesPerPixel {
+				left = int(row[i-bytesPerPixel])
+			}
+			row[i] += uint8((left + int(previous[i])) / 2)
+		}
+	case 4:
+		for i := range row {
+			var left, upperLeft int
+			if i >= bytesPerPixel {
+				left, upperLeft = int(row[i-bytesPerPixel]), int(previous[i-bytesPerPixel])
+			}
+			row[i] += paeth(left, int(previous[i]), upperLeft)
+		}
+	default:
+		return nil, fmt.Errorf("png: unknown filter type %d at row %d", filter, s.next)
+	}
+
+	s.current, s.previous = s.previous, s.current
+	return row, nil
+}
+
+func paeth(a, b, c int) uint8 {
+	p := a + b - c
+	pa, pb, pc := abs(p-a), abs(p-b), abs(p-c)
+	if pa <= pb && pa <= pc {
+		return uint8(a)
+	}
+	if pb <= pc {
+		return uint8(b)
+	}
+	return uint8(c)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// setRow converts a decoded row into the window, giving the colors the
+// image/png decoder would.
+func (s *streamedPNG) setRow(y int, row []byte) {
+	if window, ok := s.window.(*image.NRGBA64); ok {
+		pix := window.Pix[window.PixOffset(0, y):]
+		for x := 0; x < s.width; x++ {
+			var rgba [8]byte
+			switch s.colorType {
+			case pngColorGray:
+				gray := row[2*x : 2*x+2]
+				rgba = [8]byte{gray[0], gray[1], gray[0], gray[1], gray[0], gray[1], 0xff, 0xff}
+				if s.transparent != nil && string(gray) == string(s.transparent) {
+					rgba[6], rgba[7] = 0, 0
+				}
+			case pngColorTruecolor:
+				rgb := row[6*x : 6*x+6]
+				copy(rgba[:], rgb)
+				rgba[6], rgba[7] = 0xff, 0xff
+				if s.transparent != nil && string(rgb) == string(s.transparent) {
+					rgba[6], rgba[7] = 0, 0
+				}
+			case pngColorGrayAlpha:
+				ga := row[4*x : 4*x+4]
+				rgba = [8]byte{ga[0], ga[1], ga[0], ga[1], ga[0], ga[1], ga[2], ga[3]}
+			case pngColorRGBA:
+				copy(rgba[:], row[8*x:8*x+8])
+			}
+			copy(pix[8*x:], rgba[:])
+		}
+		return
+	}
+
+	window := s.window.(*image.NRGBA)
+	pix := window.Pix[window.PixOffset(0, y):]
+	for x := 0; x < s.width; x++ {
+		var c color.NRGBA
+		switch s.colorType {
+		case pngColorGray:
+			sample := s.sample(row, x)
+			max := 1<<s.depth - 1
+			gray := uint8(sample * 0xff / max)
+			c = color.NRGBA{gray, gray, gray, 0xff}
+			if s.transparent != nil && sample == int(binary.BigEndian.Uint16(s.transparent))&max {
+				c.A = 0
+			}
+		case pngColorTruecolor:
+			c = color.NRGBA{row[3*x], row[3*x+1], row[3*x+2], 0xff}
+			if t := s.transparent; t != nil && c.R == t[1] && c.G == t[3] && c.B == t[5] {
+				c.A = 0
+			}
+		case pngColorIndexed:
+			c = color.NRGBA{0, 0, 0, 0xff}
+			if index := s.sample(row, x); index < len(s.palette) {
+				c = s.palette[index]
+			}
+		case pngColorGrayAlpha:
+			c = color.NRGBA{row[2*x], row[2*x], row[2*x], row[2*x+1]}
+		case pngColorRGBA:
+			c = color.NRGBA{row[4*x], row[4*x+1], row[4*x+2], row[4*x+3]}
+		}
+		pix[4*x], pix[4*x+1], pix[4*x+2], pix[4*x+3] = c.R, c.G, c.B, c.A
+	}
+}
+
+// sample reads the x-th sample of a row packed at the bit depth.
+func (s *streamedPNG) sample(row []byte, x int) int {
+	if s.depth == 8 {
+		return int(row[x])
+	}
+	bit := x * s.depth
+	return int(row[bit/8]>>(8-s.depth-bit%8)) & (1<<s.depth - 1)
+}
+
+func readPNGChunkHeader(r io.Reader) (uint32, string, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, "", errors.New("png: file ends before the image data")
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > 1<<31-1 {
+		return 0, "", errors.New("png: bad chunk length")
+	}
+	return length, string(header[4:]), nil
+}
+
+func newPNGChunkCRC(chunkType string) hash.Hash32 {
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	return crc
+}
+
+func checkPNGChunkCRC(r io.Reader, chunkType string, crc hash.Hash32) error {
+	var stored [4]byte
+	if _, err := io.ReadFull(r, stored[:]); err != nil {
+		return fmt.Errorf("png: %s chunk is truncated", chunkType)
+	}
+	if binary.BigEndian.Uint32(stored[:]) != crc.Sum32() {
+		return fmt.Errorf("png: %s chunk checksum mismatch", chunkType)
+	}
+	return nil
+}
+
+// readPNGChunk reads the data of a small chunk the header chunks are.
+func readPNGChunk(r io.Reader, chunkType string, length uint32) ([]byte, error) {
+	if length > 0x10000 {
+		return nil, fmt.Errorf("png: %s chunk is too long", chunkType)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("png: %s chunk is truncated", chunkType)
+	}
+	crc := newPNGChunkCRC(chunkType)
+	crc.Write(data)
+	return data, checkPNGChunkCRC(r, chunkType, crc)
+}
+
+func skipPNGChunk(r io.Reader, chunkType string, length uint32) error {
+	crc := newPNGChunkCRC(chunkType)
+	if _, err := io.CopyN(crc, r, int64(length)); err != nil {
+		return fmt.Errorf("png: %s chunk is truncated", chunkType)
+	}
+	return checkPNGChunkCRC(r, chunkType, crc)
+}
+
+// pngDataReader reads the data of consecutive IDAT chunks as one stream, and
+// stops at the first other chunk.
+type pngDataReader struct {
+	r         io.Reader
+	remaining uint32
+	crc       hash.Hash32
+	done      bool
+}
+
+func (dr *pngDataReader) Read(p []byte) (int, error) {
+	for dr.remaining == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := checkPNGChunkCRC(dr.r, "IDAT", dr.crc); err != nil {
+			return 0, err
+		}
+		length, chunkType, err := readPNGChunkHeader(dr.r)
+		if err != nil {
+			return 0, err
+		}
+		if chunkType != "IDAT" {
+			dr.done = true
+			return 0, io.EOF
+		}
+		dr.remaining, dr.crc = length, newPNGChunkCRC(chunkType)
+	}
+
+	if uint32(len(p)) > dr.remaining {
+		p = p[:dr.remaining]
+	}
+	n, err := dr.r.Read(p)
+	dr.crc.Write(p[:n])
+	dr.remaining -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testImages covers the PNG color types and bit depths image/png encodes.
+func testImages() map[string]image.Image {
+	const width, height = 37, 45
+	random := rand.New(rand.NewSource(1))
+	rect := image.Rect(0, 0, width, height)
+	byteAt := func() uint8 { return uint8(random.Intn(256)) }
+
+	gray, gray16 := image.NewGray(rect), image.NewGray16(rect)
+	rgba, rgba64 := image.NewRGBA(rect), image.NewRGBA64(rect)
+	nrgba, nrgba64 := image.NewNRGBA(rect), image.NewNRGBA64(rect)
+	paletted := map[string]*image.Paletted{}
+	for _, size := range []int{2, 4, 16, 256} {
+		palette := make(color.Palette, size)
+		for i := range palette {
+			palette[i] = color.NRGBA{byteAt(), byteAt(), byteAt(), 0xff}
+		}
+		paletted[map[int]string{2: "paletted 1-bit", 4: "paletted 2-bit", 16: "paletted 4-bit", 256: "paletted 8-bit"}[size]] = image.NewPaletted(rect, palette)
+	}
+	translucent := image.NewPaletted(rect, color.Palette{color.NRGBA{0xff, 0, 0, 0x80}, color.NRGBA{0, 0, 0xff, 0}, color.NRGBA{0, 0xff, 0, 0xff}})
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Smooth gradients with noise make the encoder pick every filter.
+			base := uint8(x*5 + y*3)
+			gray.SetGray(x, y, color.Gray{base + byteAt()%8})
+			gray16.SetGray16(x, y, color.Gray16{uint16(base)<<8 | uint16(byteAt())})
+			rgba.SetRGBA(x, y, color.RGBA{base, byteAt(), base / 2, 0xff})
+			rgba64.SetRGBA64(x, y, color.RGBA64{uint16(base) << 8, uint16(byteAt()) << 4, 0x1234, 0xffff})
+			nrgba.SetNRGBA(x, y, color.NRGBA{base, byteAt(), 0x40, byteAt()})
+			nrgba64.SetNRGBA64(x, y, color.NRGBA64{uint16(base) << 8, 0x8080, uint16(byteAt()) << 8, uint16(byteAt()) << 8})
+			for _, img := range paletted {
+				img.SetColorIndex(x, y, uint8(random.Intn(len(img.Palette))))
+			}
+			translucent.SetColorIndex(x, y, uint8(random.Intn(3)))
+		}
+	}
+
+	images := map[string]image.Image{
+		"gray 8-bit": gray, "gray 16-bit": gray16,
+		"truecolor 8-bit": rgba, "truecolor 16-bit": rgba64,
+		"rgba 8-bit": nrgba, "rgba 16-bit": nrgba64,
+		"paletted with tRNS": translucent,
+	}
+	for name, img := range paletted {
+		images[name] = img
+	}
+	return images
+}
+
+func encodeTestPNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func TestStreamedPNGMatchesImageDecode(t *testing.T) {
+	for name, img := range testImages() {
+		encoded := encodeTestPNG(t, img)
+		want, err := png.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		streamed, err := newStreamedPNG(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if streamed.Bounds() != want.Bounds() {
+			t.Fatalf("%s: got bounds %v, want %v", name, streamed.Bounds(), want.Bounds())
+		}
+
+		const bandHeight = 7
+		for top := 0; top < want.Bounds().Dy(); top += bandHeight {
+			streamed.load(top, top+bandHeight)
+			for y := top; y < top+bandHeight && y < want.Bounds().Dy(); y++ {
+				for x := 0; x < want.Bounds().Dx(); x++ {
+					r, g, b, a := streamed.At(x, y).RGBA()
+					wr, wg, wb, wa := want.At(x, y).RGBA()
+					if [4]uint32{r, g, b, a} != [4]uint32{wr, wg, wb, wa} {
+						t.Fatalf("%s at %d,%d: got %04x %04x %04x %04x, want %04x %04x %04x %04x", name, x, y, r, g, b, a, wr, wg, wb, wa)
+					}
+				}
+			}
+		}
+		if err := streamed.Err(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestStreamedPNGReportsBrokenData(t *testing.T) {
+	encoded := encodeTestPNG(t, testImages()["rgba 8-bit"])
+
+	truncated, err := newStreamedPNG(bytes.NewReader(encoded[:len(encoded)/2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated.load(0, truncated.Bounds().Dy())
+	if truncated.Err() == nil {
+		t.Error("decoding a truncated image succeeded")
+	}
+
+	// Flip a byte of the IHDR chunk without fixing its checksum.
+	corrupt := append([]byte{}, encoded...)
+	corrupt[20] ^= 1
+	if _, err := newStreamedPNG(bytes.NewReader(corrupt)); err == nil {
+		t.Error("decoding an image with a bad IHDR checksum succeeded")
+	}
+
+	streamed, err := newStreamedPNG(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed.load(20, 30)
+	streamed.load(0, 10)
+	if streamed.Err() == nil {
+		t.Error("loading rows streamed past succeeded")
+	}
+}
+
+func TestPNGStreamable(t *testing.T) {
+	encoded := encodeTestPNG(t, testImages()["gray 8-bit"])
+	if !pngStreamable(encoded) {
+		t.Error("a non-interlaced PNG is not streamable")
+	}
+
+	interlaced := append([]byte{}, encoded...)
+	interlaced[28] = 1
+	if pngStreamable(interlaced) {
+		t.Error("an interlaced PNG is streamable")
+	}
+	if pngStreamable(encoded[:20]) {
+		t.Error("a truncated header is streamable")
+	}
+}
+
+func TestDecodeInputWithinMemoryLimit(t *testing.T) {
+	encoded := encodeTestPNG(t, testImages()["rgba 8-bit"])
+
+	img, err := decodeInput(bytes.NewReader(encoded), 1024, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*streamedPNG); !ok {
+		t.Errorf("got a %T, want the image streamed", img)
+	}
+
+	if _, err := decodeInput(bytes.NewReader(encoded), 1024, false); err == nil {
+		t.Error("decoding an image larger than the memory limit whole succeeded")
+	}
+
+	img, err = decodeInput(bytes.NewReader(encoded), 1<<20, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := img.(*image.NRGBA); !ok {
+		t.Errorf("got a %T, want the image decoded whole", img)
+	}
+}
+
+// TestStreamedMappingMatchesWholeImage maps a translucent image in bands
+// from a streamed source and whole from a decoded one.
+func TestStreamedMappingMatchesWholeImage(t *testing.T) {
+	var settings Settings
+	if err := yaml.Unmarshal([]byte(`palette: ["#000000", "#ff0000", "#00ff00", "#0000ff", "#ffffff"]`), &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	source := image.NewNRGBA(image.Rect(0, 0, 64, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 64; x++ {
+			source.SetNRGBA(x, y, color.NRGBA{uint8(x * 4), uint8(y * 2), uint8(x + y), uint8(y * 255 / 99)})
+		}
+	}
+	encoded := encodeTestPNG(t, source)
+
+	pool := newWorkerPool(2)
+	defer pool.Close()
+
+	whole, err := NewImageMapper(settings, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := whole.QuantizeColorsToPalette(pool).MappedImage
+	for i := 3; i < len(want.Pix); i += 4 {
+		if want.Pix[i] != 0xff {
+			t.Fatal("mapped pixels are not opaque, bandedImage.Opaque is wrong")
+		}
+	}
+
+	settings.MemoryLimit = 70000
+	streamed, err := decodeInput(bytes.NewReader(encoded), settings.MemoryLimit, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapper, err := NewImageMapper(settings, streamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bandHeight := mapper.BandHeight(); bandHeight >= 100 {
+		t.Fatalf("got band height %d, want several bands", bandHeight)
+	}
+
+	var got, wantPNG bytes.Buffer
+	if err := png.Encode(&got, mapper.Output(pool)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mapper.SourceErr(); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&wantPNG, want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), wantPNG.Bytes()) {
+		t.Error("the image mapped in bands differs from the image mapped whole")
+	}
+}
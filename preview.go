@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const defaultPreviewFilter = "lanczos"
+
+// parseDimensions parses a WIDTHxHEIGHT string. Either side may be 0 to leave
+// it unconstrained.
+func parseDimensions(raw string) (image.Point, error) {
+	rawWidth, rawHeight, ok := strings.Cut(strings.ToLower(raw), "x")
+	if !ok {
+		return image.Point{}, fmt.Errorf("invalid dimensions %q, expected WIDTHxHEIGHT", raw)
+	}
+
+	width, err := strconv.Atoi(rawWidth)
+	if err != nil || width < 0 {
+		return image.Point{}, fmt.Errorf("invalid width in %q", raw)
+	}
+	height, err := strconv.Atoi(rawHeight)
+	if err != nil || height < 0 {
+		return image.Point{}, fmt.Errorf("invalid height in %q", raw)
+	}
+	if width == 0 && height == 0 {
+		return image.Point{}, fmt.Errorf("dimensions %q leave both sides unconstrained", raw)
+	}
+
+	return image.Point{X: width, Y: height}, nil
+}
+
+// fitWithin scales size down to fit within bounds, keeping its aspect ratio.
+// It never scales up.
+func fitWithin(size, bounds image.Point) image.Point {
+	scale := 1.0
+	if bounds.X > 0 {
+		scale = math.Min(scale, float64(bounds.X)/float64(size.X))
+	}
+	if bounds.Y > 0 {
+		scale = math.Min(scale, float64(bounds.Y)/float64(size.Y))
+	}
+
+	return image.Point{
+		X: int(math.Max(1, math.Round(float64(size.X)*scale))),
+		Y: int(math.Max(1, math.Round(float64(size.Y)*scale))),
+	}
+}
+
+// previewImage downsamples loadedImage to fit within maxSize.
+func previewImage(loadedImage image.Image, maxSize image.Point, filter string) (image.Image, error) {
+	if filter == "" {
+		filter = defaultPreviewFilter
+	}
+
+	size := fitWithin(loadedImage.Bounds().Size(), maxSize)
+	if size == loadedImage.Bounds().Size() {
+		return loadedImage, nil
+	}
+
+	return resampleImage(loadedImage, size.X, size.Y, filter)
+}
+
+// NewPreviewMapper returns a mapper for loadedImage downsampled to fit within
+// maxSize.
+func NewPreviewMapper(settings Settings, loadedImage image.Image, maxSize image.Point, filter string) (*ImageMapper, error) {
+	img, err := previewImage(loadedImage, maxSize, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewImageMapper(settings, img)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const palettesDirName = "palettes"
+
+// settingsExtensions are the file extensions of profiles.
+var settingsExtensions = []string{".yaml", ".yml"}
+
+// configDir is where profiles and the palette library live:
+// $XDG_CONFIG_HOME/img2theme, or the platform's user config directory.
+func configDir() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		userConfigDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		configHome = userConfigDir
+	}
+
+	return filepath.Join(configHome, "img2theme"), nil
+}
+
+// libraryEntry is a profile or palette found in the config directory.
+type libraryEntry struct {
+	Name string
+	Path string
+}
+
+// listLibrary returns the files of dir with one of extensions by name,
+// sorted. A missing directory holds nothing.
+func listLibrary(dir string, extensions []string) ([]libraryEntry, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []libraryEntry
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		extension := filepath.Ext(file.Name())
+		for _, known := range extensions {
+			if extension == known {
+				entries = append(entries, libraryEntry{
+					Name: strings.TrimSuffix(file.Name(), extension),
+					Path: filepath.Join(dir, file.Name()),
+				})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// findInLibrary looks up name among the files of dir, kind names what is
+// looked up in errors.
+func findInLibrary(dir, kind, name string) (string, error) {
+	entries, err := listLibrary(dir, settingsExtensions)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		if entry.Name == name {
+			return entry.Path, nil
+		}
+		names[i] = entry.Name
+	}
+
+	if len(names) == 0 {
+		return "", fmt.Errorf("unknown %s %q, %s has none", kind, name, dir)
+	}
+	return "", fmt.Errorf("unknown %s %q, expected one of %s", kind, name, strings.Join(names, ", "))
+}
+
+func profilePath(name string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return findInLibrary(dir, "profile", name)
+}
+
+func palettesDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, palettesDirName), nil
+}
+
+// loadNamedPalette reads a palette from the library, the catalog or, for
+// terminal, the controlling terminal.
+func loadNamedPalette(name string) (Palette, error) {
+	if name == terminalPaletteName {
+		palette, err := loadTerminalPalette()
+		if err != nil {
+			return nil, fmt.Errorf("%q could not be queried: %w", name, err)
+		}
+		return palette, nil
+	}
+
+	dir, err := palettesDir()
+	if err != nil {
+		return nil, err
+	}
+	library, err := listLibrary(dir, paletteFileExtensions())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range library {
+		if entry.Name != name {
+			continue
+		}
+
+		palette, err := loadPaletteFile(entry.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%q is invalid: %w", name, err)
+		}
+		return palette, nil
+	}
+
+	palette, ok, err := loadCatalogPalette(name)
+	if err != nil {
+		return nil, fmt.Errorf("%q is invalid: %w", name, err)
+	}
+	if ok {
+		return palette, nil
+	}
+
+	names := append(catalogPaletteNames(), terminalPaletteName)
+	for _, entry := range library {
+		names = append(names, entry.Name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown palette %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// loadPaletteFile reads a palette file in any of the paletteFormats, told
+// apart by extension.
+func loadPaletteFile(filePath string) (Palette, error) {
+	format, err := paletteFormatByName("", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rawPalette, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	palette, err := format.Read(rawPalette)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return palette, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+)
+
+var profilesCommand = &cli.Command{
+	Name:  "profiles",
+	Usage: "Work with the profiles and palettes under $XDG_CONFIG_HOME/img2theme",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "List the profiles usable with --profile and the palettes usable as palette: NAME",
+			Action: profilesListAction,
+		},
+	},
+}
+
+func profilesListAction(c *cli.Context) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	profiles, err := listLibrary(dir, settingsExtensions)
+	if err != nil {
+		return err
+	}
+
+	palettesPath, err := palettesDir()
+	if err != nil {
+		return err
+	}
+	palettes, err := listLibrary(palettesPath, paletteFileExtensions())
+	if err != nil {
+		return err
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(table, "profiles in %s:\n", dir)
+	if len(profiles) == 0 {
+		fmt.Fprintln(table, "  none")
+	}
+	for _, profile := range profiles {
+		fmt.Fprintf(table, "  %s\t%s\n", profile.Name, profile.Path)
+	}
+
+	fmt.Fprintf(table, "palettes in %s:\n", palettesPath)
+	if len(palettes) == 0 {
+		fmt.Fprintln(table, "  none")
+	}
+	for _, palette := range palettes {
+		colors, err := loadPaletteFile(palette.Path)
+		if err != nil {
+			fmt.Fprintf(table, "  %s\tinvalid: %v\n", palette.Name, err)
+			continue
+		}
+		fmt.Fprintf(table, "  %s\t%d colors\n", palette.Name, len(colors))
+	}
+
+	return table.Flush()
+}
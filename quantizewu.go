@@ -0,0 +1,233 @@
+package main
+
+import "github.com/lucasb-eyer/go-colorful"
+
+// Wu's color quantizer from Graphics Gems II, on bins of 5 bits per channel.
+
+const wuSide = 33
+
+type wuBox struct {
+	r0, r1, g0, g1, b0, b1 int
+}
+
+// wuMoments are cumulative sums over bins [0, r] x [0, g] x [0, b], index 0
+// of every axis being empty so that boxes can start below the first bin.
+type wuMoments struct {
+	weight, r, g, b, squares []float64
+}
+
+func wuIndex(r, g, b int) int {
+	return r*wuSide*wuSide + g*wuSide + b
+}
+
+func newWuMoments(colors []weightedColor) *wuMoments {
+	size := wuSide * wuSide * wuSide
+	m := &wuMoments{
+		weight:  make([]float64, size),
+		r:       make([]float64, size),
+		g:       make([]float64, size),
+		b:       make([]float64, size),
+		squares: make([]float64, size),
+	}
+
+	for _, c := range colors {
+		r, g, b := c.Color.RGB255()
+		i := wuIndex(int(r>>3)+1, int(g>>3)+1, int(b>>3)+1)
+		fr, fg, fb := float64(r), float64(g), float64(b)
+		m.weight[i] += c.Weight
+		m.r[i] += fr * c.Weight
+		m.g[i] += fg * c.Weight
+		m.b[i] += fb * c.Weight
+		m.squares[i] += (fr*fr + fg*fg + fb*fb) * c.Weight
+	}
+
+	for _, moment := range [][]float64{m.weight, m.r, m.g, m.b, m.squares} {
+		for r := 1; r < wuSide; r++ {
+			var area [wuSide]float64
+			for g := 1; g < wuSide; g++ {
+				line := 0.0
+				for b := 1; b < wuSide; b++ {
+					line += moment[wuIndex(r, g, b)]
+					area[b] += line
+					moment[wuIndex(r, g, b)] = moment[wuIndex(r-1, g, b)] + area[b]
+				}
+			}
+		}
+	}
+	return m
+}
+
+func (box wuBox) volume(moment []float64) float64 {
+	return moment[wuIndex(box.r1, box.g1, box.b1)] -
+		moment[wuIndex(box.r1, box.g1, box.b0)] -
+		moment[wuIndex(box.r1, box.g0, box.b1)] +
+		moment[wuIndex(box.r1, box.g0, box.b0)] -
+		moment[wuIndex(box.r0, box.g1, box.b1)] +
+		moment[wuIndex(box.r0, box.g1, box.b0)] +
+		moment[wuIndex(box.r0, box.g0, box.b1)] -
+		moment[wuIndex(box.r0, box.g0, box.b0)]
+}
+
+// bottom is the part of volume that does not depend on where the box is cut
+// along axis, top the part that does.
+func (box wuBox) bottom(axis int, moment []float64) float64 {
+	switch axis {
+	case 0:
+		return -moment[wuIndex(box.r0, box.g1, box.b1)] +
+			moment[wuIndex(box.r0, box.g1, box.b0)] +
+			moment[wuIndex(box.r0, box.g0, box.b1)] -
+			moment[wuIndex(box.r0, box.g0, box.b0)]
+	case 1:
+		return -moment[wuIndex(box.r1, box.g0, box.b1)] +
+			moment[wuIndex(box.r1, box.g0, box.b0)] +
+			moment[wuIndex(box.r0, box.g0, box.b1)] -
+			moment[wuIndex(box.r0, box.g0, box.b0)]
+	}
+	return -moment[wuIndex(box.r1, box.g1, box.b0)] +
+		moment[wuIndex(box.r1, box.g0, box.b0)] +
+		moment[wuIndex(box.r0, box.g1, box.b0)] -
+		moment[wuIndex(box.r0, box.g0, box.b0)]
+}
+
+func (box wuBox) top(axis, position int, moment []float64) float64 {
+	switch axis {
+	case 0:
+		return moment[wuIndex(position, box.g1, box.b1)] -
+			moment[wuIndex(position, box.g1, box.b0)] -
+			moment[wuIndex(position, box.g0, box.b1)] +
+			moment[wuIndex(position, box.g0, box.b0)]
+	case 1:
+		return moment[wuIndex(box.r1, position, box.b1)] -
+			moment[wuIndex(box.r1, position, box.b0)] -
+			moment[wuIndex(box.r0, position, box.b1)] +
+			moment[wuIndex(box.r0, position, box.b0)]
+	}
+	return moment[wuIndex(box.r1, box.g1, position)] -
+		moment[wuIndex(box.r1, box.g0, position)] -
+		moment[wuIndex(box.r0, box.g1, position)] +
+		moment[wuIndex(box.r0, box.g0, position)]
+}
+
+func (box wuBox) variance(m *wuMoments) float64 {
+	weight := box.volume(m.weight)
+	if weight == 0 {
+		return 0
+	}
+	r, g, b := box.volume(m.r), box.volume(m.g), box.volume(m.b)
+	return box.volume(m.squares) - (r*r+g*g+b*b)/weight
+}
+
+func (box wuBox) bins() int {
+	return (box.r1 - box.r0) * (box.g1 - box.g0) * (box.b1 - box.b0)
+}
+
+func (box wuBox) bounds(axis int) (int, int) {
+	switch axis {
+	case 0:
+		return box.r0, box.r1
+	case 1:
+		return box.g0, box.g1
+	}
+	return box.b0, box.b1
+}
+
+// maximize finds the cut along axis that leaves the two halves with the
+// largest sum of squared means, or -1 when no cut leaves both halves filled.
+func (box wuBox) maximize(axis int, m *wuMoments) (float64, int) {
+	wholeWeight := box.volume(m.weight)
+	wholeR, wholeG, wholeB := box.volume(m.r), box.volume(m.g), box.volume(m.b)
+	baseWeight := box.bottom(axis, m.weight)
+	baseR, baseG, baseB := box.bottom(axis, m.r), box.bottom(axis, m.g), box.bottom(axis, m.b)
+
+	best, cut := 0.0, -1
+	first, last := box.bounds(axis)
+	for position := first + 1; position < last; position++ {
+		halfWeight := baseWeight + box.top(axis, position, m.weight)
+		if halfWeight == 0 || halfWeight == wholeWeight {
+			continue
+		}
+		halfR := baseR + box.top(axis, position, m.r)
+		halfG := baseG + box.top(axis, position, m.g)
+		halfB := baseB + box.top(axis, position, m.b)
+
+		score := (halfR*halfR + halfG*halfG + halfB*halfB) / halfWeight
+		halfR, halfG, halfB = wholeR-halfR, wholeG-halfG, wholeB-halfB
+		score += (halfR*halfR + halfG*halfG + halfB*halfB) / (wholeWeight - halfWeight)
+
+		if score > best {
+			best, cut = score, position
+		}
+	}
+	return best, cut
+}
+
+// split cuts box in two along the axis that separates its colors best.
+func (box wuBox) split(m *wuMoments) (wuBox, wuBox, bool) {
+	bestScore, bestAxis, bestCut := 0.0, -1, -1
+	for axis := 0; axis < 3; axis++ {
+		score, cut := box.maximize(axis, m)
+		if cut >= 0 && score > bestScore {
+			bestScore, bestAxis, bestCut = score, axis, cut
+		}
+	}
+	if bestAxis < 0 {
+		return box, box, false
+	}
+
+	lower, upper := box, box
+	switch bestAxis {
+	case 0:
+		lower.r1, upper.r0 = bestCut, bestCut
+	case 1:
+		lower.g1, upper.g0 = bestCut, bestCut
+	case 2:
+		lower.b1, upper.b0 = bestCut, bestCut
+	}
+	return lower, upper, true
+}
+
+func wuQuantize(colors []weightedColor, n int, _ extractOptions) []colorful.Color {
+	m := newWuMoments(colors)
+	boxes := []wuBox{{r1: wuSide - 1, g1: wuSide - 1, b1: wuSide - 1}}
+	variances := []float64{boxes[0].variance(m)}
+
+	for len(boxes) < n {
+		next := 0
+		for i, variance := range variances {
+			if variance > variances[next] {
+				next = i
+			}
+		}
+		if variances[next] <= 0 {
+			break
+		}
+
+		lower, upper, ok := boxes[next].split(m)
+		if !ok {
+			variances[next] = 0
+			continue
+		}
+		boxes[next], variances[next] = lower, 0
+		boxes = append(boxes, upper)
+		variances = append(variances, 0)
+		for _, i := range []int{next, len(boxes) - 1} {
+			if boxes[i].bins() > 1 {
+				variances[i] = boxes[i].variance(m)
+			}
+		}
+	}
+
+	var palette []colorful.Color
+	for _, box := range boxes {
+		weight := box.volume(m.weight)
+		if weight == 0 {
+			continue
+		}
+		palette = append(palette, colorful.Color{
+			R: box.volume(m.r) / weight / 255,
+			G: box.volume(m.g) / weight / 255,
+			B: box.volume(m.b) / weight / 255,
+		})
+	}
+	return palette
+}
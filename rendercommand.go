@@ -0,0 +1,52 @@
+package main
+
+import (
+	"image/jpeg"
+	"log"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+var renderCommand = &cli.Command{
+	Name:      "render",
+	Usage:     "Re-render an image from matches saved with --save-matches, without searching the palette again.\nExample usage: img2theme render --matches image.matches settings.yaml >output.jpg",
+	ArgsUsage: "[settings.yaml...]",
+	Flags: append(settingsFlags(),
+		&cli.StringFlag{
+			Name:     "matches",
+			Usage:    "match file written by --save-matches",
+			Required: true,
+		},
+	),
+	Action: renderAction,
+}
+
+func renderAction(c *cli.Context) error {
+	settings, err := loadSettings(c)
+	if err != nil {
+		return err
+	}
+
+	matchMap, err := loadMatchMap(c.String("matches"))
+	if err != nil {
+		return err
+	}
+
+	pool := newWorkerPool(availableCPUs(settings.Cpus))
+	defer pool.Close()
+
+	rendered, err := matchMap.Render(pool, settings)
+	if err != nil {
+		return err
+	}
+
+	err = jpeg.Encode(os.Stdout, rendered, nil)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Image rendered and written to stdout")
+
+	return nil
+}
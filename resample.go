@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+type resampleFilter struct {
+	support float64
+	kernel  func(x float64) float64
+}
+
+var resampleFilters = map[string]resampleFilter{
+	"box": {
+		support: 0.5,
+		kernel: func(x float64) float64 {
+			if x >= -0.5 && x < 0.5 {
+				return 1
+			}
+			return 0
+		},
+	},
+	"lanczos": {
+		support: 3,
+		kernel: func(x float64) float64 {
+			if x == 0 {
+				return 1
+			}
+			if x <= -3 || x >= 3 {
+				return 0
+			}
+			return 3 * math.Sin(math.Pi*x) * math.Sin(math.Pi*x/3) / (math.Pi * math.Pi * x * x)
+		},
+	},
+}
+
+type resampleWeights struct {
+	start  int
+	values []float64
+}
+
+// computeResampleWeights returns the normalized filter weights of every
+// destination pixel along one axis.
+func computeResampleWeights(srcSize, dstSize int, filter resampleFilter) []resampleWeights {
+	scale := float64(srcSize) / float64(dstSize)
+	filterScale := math.Max(scale, 1)
+	support := filter.support * filterScale
+	weights := make([]resampleWeights, dstSize)
+
+	for i := range weights {
+		center := (float64(i) + 0.5) * scale
+		start := int(math.Max(0, math.Floor(center-support)))
+		end := int(math.Min(float64(srcSize), math.Ceil(center+support)))
+
+		values := make([]float64, end-start)
+		sum := 0.0
+		for j := range values {
+			values[j] = filter.kernel((float64(start+j) + 0.5 - center) / filterScale)
+			sum += values[j]
+		}
+		if sum != 0 {
+			for j := range values {
+				values[j] /= sum
+			}
+		}
+
+		weights[i] = resampleWeights{start: start, values: values}
+	}
+
+	return weights
+}
+
+func resampleFilterByName(name string) (resampleFilter, error) {
+	filter, ok := resampleFilters[name]
+	if !ok {
+		return resampleFilter{}, fmt.Errorf("unknown resample filter %q, expected box or lanczos", name)
+	}
+	return filter, nil
+}
+
+// resampleImage scales img to width×height, keeping only the source rows the
+// current output rows need.
+func resampleImage(img image.Image, width, height int, filterName string) (*image.RGBA, error) {
+	filter, err := resampleFilterByName(filterName)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	columnWeights := computeResampleWeights(bounds.Dx(), width, filter)
+	rowWeights := computeResampleWeights(bounds.Dy(), height, filter)
+
+	srcRow := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), 1))
+	rows := map[int][]float64{}
+	var free [][]float64
+	horizontalRow := func(y int) []float64 {
+		if row, ok := rows[y]; ok {
+			return row
+		}
+		draw.Draw(srcRow, srcRow.Bounds(), img, image.Pt(bounds.Min.X, bounds.Min.Y+y), draw.Src)
+
+		var row []float64
+		if len(free) > 0 {
+			row, free = free[len(free)-1], free[:len(free)-1]
+		} else {
+			row = make([]float64, width*4)
+		}
+		for x, w := range columnWeights {
+			var sum [4]float64
+			for j, weight := range w.values {
+				in := srcRow.Pix[(w.start+j)*4:]
+				sum[0] += float64(in[0]) * weight
+				sum[1] += float64(in[1]) * weight
+				sum[2] += float64(in[2]) * weight
+				sum[3] += float64(in[3]) * weight
+			}
+			copy(row[x*4:], sum[:])
+		}
+		rows[y] = row
+		return row
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	sums := make([]float64, width*4)
+	for y, w := range rowWeights {
+		// Row windows only move down, rows above this one are done with.
+		for rowY, row := range rows {
+			if rowY < w.start {
+				free = append(free, row)
+				delete(rows, rowY)
+			}
+		}
+
+		for i := range sums {
+			sums[i] = 0
+		}
+		for j, weight := range w.values {
+			for i, value := range horizontalRow(w.start + j) {
+				sums[i] += value * weight
+			}
+		}
+
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			// Lanczos lobes overshoot, a premultiplied channel above its
+			// alpha would come out brighter than white.
+			alpha := clampChannel(sums[x*4+3], 255)
+			out[x*4+3] = uint8(alpha)
+			for channel := 0; channel < 3; channel++ {
+				out[x*4+channel] = uint8(clampChannel(sums[x*4+channel], alpha))
+			}
+		}
+	}
+
+	return dst, nil
+}
+
+func clampChannel(value, max float64) float64 {
+	return math.Max(0, math.Min(max, math.Round(value)))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestResampleKeepsPremultipliedChannels downsamples stripes of transparent,
+// white and black pixels, where Lanczos lobes overshoot the color channels
+// more than the alpha channel.
+func TestResampleKeepsPremultipliedChannels(t *testing.T) {
+	const stripes = "2122101011220010200000220100102221000110"
+	src := image.NewNRGBA(image.Rect(0, 0, len(stripes), 4))
+	for x, stripe := range stripes {
+		c := map[rune]color.NRGBA{'0': {}, '1': {0xff, 0xff, 0xff, 0xff}, '2': {0, 0, 0, 0xff}}[stripe]
+		for y := 0; y < 4; y++ {
+			src.SetNRGBA(x, y, c)
+		}
+	}
+
+	for name := range resampleFilters {
+		dst, err := resampleImage(src, 13, 4, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(dst.Pix); i += 4 {
+			for channel := 0; channel < 3; channel++ {
+				if dst.Pix[i+channel] > dst.Pix[i+3] {
+					t.Fatalf("%s: pixel %d has channel %d at %d above its alpha %d", name, i/4, channel, dst.Pix[i+channel], dst.Pix[i+3])
+				}
+			}
+		}
+	}
+
+	if _, err := resampleImage(src, 13, 4, "bicubic"); err == nil {
+		t.Error("resampling with an unknown filter succeeded")
+	}
+}
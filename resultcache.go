@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultResultCacheMaxSize = ByteSize(1 << 30)
+
+// ResultCache stores encoded outputs on disk under a hash of everything that
+// determines them, so unchanged runs skip decoding and mapping entirely.
+type ResultCache struct {
+	Dir     string
+	MaxSize ByteSize
+}
+
+type ResultCacheStats struct {
+	Entries int
+	Stamps  int
+	Size    ByteSize
+}
+
+type resultCacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	stamp   bool
+}
+
+func resultCacheDir() (string, error) {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		cacheHome = userCacheDir
+	}
+
+	return filepath.Join(cacheHome, "img2theme"), nil
+}
+
+func NewResultCache(maxSize ByteSize) (*ResultCache, error) {
+	dir, err := resultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if maxSize == 0 {
+		maxSize = defaultResultCacheMaxSize
+	}
+
+	return &ResultCache{Dir: dir, MaxSize: maxSize}, nil
+}
+
+// normalizedSettings drops the settings that only affect how fast an image is
+// mapped, not what it looks like, and fills in defaults that change nothing.
+func normalizedSettings(settings Settings) Settings {
+	settings.Cpus = 0
+	settings.ColorCacheSize = 0
+	settings.ColorCacheEviction = ""
+	settings.TileSize = 0
+	settings.MemoryLimit = 0
+	settings.ResultCache = false
+	settings.ResultCacheMaxSize = 0
+	if settings.ColorCacheKeyBits == 0 {
+		settings.ColorCacheKeyBits = defaultColorCacheKeyBits
+	}
+	if settings.Metric == "" {
+		settings.Metric = defaultColorMetric
+	}
+
+	return settings
+}
+
+// hashInput digests the raw input bytes for ResultCacheKey.
+func hashInput(input io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, input); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+var (
+	buildRevisionOnce  sync.Once
+	buildRevisionValue string
+)
+
+// buildRevision identifies the build that maps images, so that results of
+// other builds are not reused.
+func buildRevision() string {
+	buildRevisionOnce.Do(func() { buildRevisionValue = readBuildRevision() })
+	return buildRevisionValue
+}
+
+func readBuildRevision() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		revision, modified := "", ""
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value
+			}
+		}
+		if revision != "" && modified != "true" {
+			return revision
+		}
+	}
+
+	// Builds without a clean VCS revision, like `go run` or a dirty tree,
+	// are told apart by the executable itself.
+	if executable, err := os.Executable(); err == nil {
+		if file, err := os.Open(executable); err == nil {
+			defer file.Close()
+			if digest, err := hashInput(file); err == nil {
+				return hex.EncodeToString(digest)
+			}
+		}
+	}
+	return version
+}
+
+// ResultCacheKey hashes the build revision, the normalized settings, any extra
+// options that change the output and the digest of the raw input.
+func ResultCacheKey(inputDigest []byte, settings Settings, options ...string) (string, error) {
+	rawSettings, err := yaml.Marshal(normalizedSettings(settings))
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, part := range append([]string{buildRevision(), string(rawSettings)}, options...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(inputDigest)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// path is where the output stored under key is kept, named with the
+// extension of its format, like ".png".
+func (rc *ResultCache) path(key, format string) string {
+	return filepath.Join(rc.Dir, key[:2], key+format)
+}
+
+// Open returns the stored output for key and marks it as recently used.
+func (rc *ResultCache) Open(key, format string) (*os.File, bool) {
+	path := rc.path(key, format)
+	output, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return output, true
+}
+
+// Create starts storing an output under key, it is only stored once
+// committed with Commit.
+func (rc *ResultCache) Create(key, format string) (*atomicFile, error) {
+	path := rc.path(key, format)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	return createFileAtomic(path)
+}
+
+// Commit stores an output started with Create, then prunes the cache back
+// below its size limit.
+func (rc *ResultCache) Commit(entry *atomicFile) error {
+	if err := entry.Commit(); err != nil {
+		return err
+	}
+
+	_, _, err := rc.Prune(rc.MaxSize)
+	return err
+}
+
+// atomicFile is written under a temporary name next to its path and renamed
+// into place by Commit, so readers never see a partially written file.
+type atomicFile struct {
+	*os.File
+	path string
+	done bool
+}
+
+func createFileAtomic(path string) (*atomicFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	// CreateTemp makes the file private, give it the usual permissions.
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return &atomicFile{File: tmp, path: path}, nil
+}
+
+func (f *atomicFile) Commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+// Abort drops the file unless it was committed.
+func (f *atomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	f, err := createFileAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// entries lists the stored outputs and the output stamps, leaving out files
+// still being written.
+func (rc *ResultCache) entries() ([]resultCacheEntry, error) {
+	var entries []resultCacheEntry
+	stampsDir := filepath.Join(rc.Dir, "stamps")
+
+	err := filepath.WalkDir(rc.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, resultCacheEntry{
+			path:    path,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			stamp:   filepath.Dir(path) == stampsDir,
+		})
+		return nil
+	})
+
+	return entries, err
+}
+
+func (rc *ResultCache) Stats() (ResultCacheStats, error) {
+	entries, err := rc.entries()
+	if err != nil {
+		return ResultCacheStats{}, err
+	}
+
+	var stats ResultCacheStats
+	for _, entry := range entries {
+		if entry.stamp {
+			stats.Stamps++
+		} else {
+			stats.Entries++
+		}
+		stats.Size += ByteSize(entry.size)
+	}
+
+	return stats, nil
+}
+
+// Prune removes the least recently used entries and stamps until the cache
+// fits in maxSize.
+func (rc *ResultCache) Prune(maxSize ByteSize) (int, ByteSize, error) {
+	entries, err := rc.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	removed := 0
+	var freed ByteSize
+	for _, entry := range entries {
+		if total <= int64(maxSize) {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil {
+			return removed, freed, err
+		}
+		total -= entry.size
+		freed += ByteSize(entry.size)
+		removed++
+	}
+
+	return removed, freed, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultCacheKey(t *testing.T) {
+	digest, err := hashInput(strings.NewReader("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := Settings{Palette: testPalette(), PaletteAffinity: 0.5}
+	key := func(settings Settings, digest []byte, options ...string) string {
+		t.Helper()
+		key, err := ResultCacheKey(digest, settings, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	base := key(settings, digest, "format=.png")
+
+	same := settings
+	same.Cpus, same.TileSize, same.MemoryLimit, same.Metric = 3, 64, 1<<20, defaultColorMetric
+	if got := key(same, digest, "format=.png"); got != base {
+		t.Error("settings that change nothing in the output changed the key")
+	}
+
+	other := settings
+	other.PaletteAffinity = 0.6
+	otherDigest, _ := hashInput(strings.NewReader("other image"))
+	for name, got := range map[string]string{
+		"palette affinity": key(other, digest, "format=.png"),
+		"input":            key(settings, otherDigest, "format=.png"),
+		"format":           key(settings, digest, "format=.jpg"),
+	} {
+		if got == base {
+			t.Errorf("a different %s kept the key", name)
+		}
+	}
+}
+
+func TestResultCacheStoresAndPrunes(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	cache, err := NewResultCache(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := func(key, format, content string) {
+		t.Helper()
+		entry, err := cache.Create(key, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(entry, content)
+		if err := cache.Commit(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	older, newer := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	store(older, ".png", "older png")
+	store(older, ".jpg", "older jpg")
+	store(newer, ".png", "newer png")
+	aborted, err := cache.Create(newer, ".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(aborted, "partial")
+	aborted.Abort()
+
+	for key, want := range map[string]string{older + ".png": "older png", older + ".jpg": "older jpg", newer + ".png": "newer png"} {
+		output, ok := cache.Open(key[:64], key[64:])
+		if !ok {
+			t.Fatalf("%s is not stored", key)
+		}
+		got, _ := io.ReadAll(output)
+		output.Close()
+		if string(got) != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := cache.Open(newer, ".jpg"); ok {
+		t.Error("an aborted output was stored")
+	}
+
+	stamp := filepath.Join(cache.Dir, "stamps", "output")
+	if err := os.MkdirAll(filepath.Dir(stamp), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stamp, []byte("stamp"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := cache.Stats(); err != nil || stats.Entries != 3 || stats.Stamps != 1 || stats.Size != 32 {
+		t.Fatalf("got %+v, %v, want 3 entries and a stamp of 32 bytes", stats, err)
+	}
+
+	// Use everything but the older png, which is then pruned first.
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(cache.path(older, ".png"), past, past)
+	removed, freed, err := cache.Prune(25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 || freed != 9 {
+		t.Errorf("pruned %d entries of %d bytes, want 1 of 9", removed, freed)
+	}
+	if _, ok := cache.Open(older, ".png"); ok {
+		t.Error("the least recently used entry survived")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Settings fields describe themselves with struct tags, which both the JSON
+// Schema and validateSettings read, so the two cannot disagree:
+//
+//	desc:"..."          description shown by editors
+//	minimum/maximum:"n" inclusive range of a number
+//	enum:"a,b"          allowed values of a string, the empty string means unset
+//	minItems:"n"        minimum length of a list
+
+// jsonSchemaProvider is implemented by setting types that are not plain Go
+// values in YAML, such as colors and byte sizes.
+type jsonSchemaProvider interface {
+	JSONSchema() map[string]interface{}
+}
+
+var jsonSchemaProviderType = reflect.TypeOf((*jsonSchemaProvider)(nil)).Elem()
+
+func settingsSchema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(Settings{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "img2theme settings"
+	return schema
+}
+
+func yamlFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t.Implements(jsonSchemaProviderType) {
+		return reflect.Zero(t).Interface().(jsonSchemaProvider).JSONSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("yaml") == "-" {
+				continue
+			}
+			properties[yamlFieldName(field)] = fieldSchema(field)
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+
+	return map[string]interface{}{}
+}
+
+func fieldSchema(field reflect.StructField) map[string]interface{} {
+	schema := typeSchema(field.Type)
+
+	if description := field.Tag.Get("desc"); description != "" {
+		schema["description"] = description
+	}
+	for _, keyword := range []string{"minimum", "maximum", "minItems"} {
+		if raw := field.Tag.Get(keyword); raw != "" {
+			value, _ := strconv.ParseFloat(raw, 64)
+			schema[keyword] = value
+		}
+	}
+	if raw := field.Tag.Get("enum"); raw != "" {
+		// The empty string leaves the default, as validateField allows.
+		schema["enum"] = append(strings.Split(raw, ","), "")
+	}
+
+	return schema
+}
+
+// validateSettings checks the values that decode fine but break the limits
+// declared in the struct tags of Settings.
+func validateSettings(settings Settings) []SettingsProblem {
+	problems := validateValue(reflect.ValueOf(settings), "")
+	if len(settings.Mappings) == 0 {
+		return problems
+	}
+
+	// The top level palette is only a fallback for mappings without one,
+	// validateMappings tells which of them miss it.
+	kept := problems[:0]
+	for _, problem := range problems {
+		if problem.Path != "palette" || len(settings.Palette) > 0 {
+			kept = append(kept, problem)
+		}
+	}
+	return append(kept, validateMappings(settings)...)
+}
+
+func validateValue(value reflect.Value, path string) []SettingsProblem {
+	var problems []SettingsProblem
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type().Implements(jsonSchemaProviderType) {
+			return nil
+		}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() || field.Tag.Get("yaml") == "-" {
+				continue
+			}
+
+			fieldPath := yamlFieldName(field)
+			if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			problems = append(problems, validateField(field, value.Field(i), fieldPath)...)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			problems = append(problems, validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Ptr:
+		if !value.IsNil() {
+			problems = append(problems, validateValue(value.Elem(), path)...)
+		}
+	}
+
+	return problems
+}
+
+func validateField(field reflect.StructField, value reflect.Value, path string) []SettingsProblem {
+	var problems []SettingsProblem
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, SettingsProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	minimum, hasMinimum := floatTag(field, "minimum")
+	maximum, hasMaximum := floatTag(field, "maximum")
+
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		var number float64
+		if value.CanInt() {
+			number = float64(value.Int())
+		} else {
+			number = value.Float()
+		}
+
+		switch {
+		case hasMinimum && hasMaximum && (number < minimum || number > maximum):
+			add("must be between %v and %v, got %v", minimum, maximum, number)
+		case hasMinimum && !hasMaximum && number < minimum:
+			add("must be at least %v, got %v", minimum, number)
+		case hasMaximum && !hasMinimum && number > maximum:
+			add("must be at most %v, got %v", maximum, number)
+		}
+	case reflect.String:
+		if raw := field.Tag.Get("enum"); raw != "" && value.String() != "" {
+			allowed := strings.Split(raw, ",")
+			found := false
+			for _, option := range allowed {
+				found = found || option == value.String()
+			}
+			if !found {
+				add("must be one of %s, got %q", strings.Join(allowed, ", "), value.String())
+			}
+		}
+	case reflect.Slice:
+		if minItems, ok := floatTag(field, "minItems"); ok && float64(value.Len()) < minItems {
+			if minItems == 1 {
+				add("must not be empty")
+			} else {
+				add("must contain at least %v entries", minItems)
+			}
+		}
+	}
+
+	return append(problems, validateValue(value, path)...)
+}
+
+func floatTag(field reflect.StructField, name string) (float64, bool) {
+	raw := field.Tag.Get(name)
+	if raw == "" {
+		return 0, false
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	return value, err == nil
+}
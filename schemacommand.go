@@ -0,0 +1,19 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+var schemaCommand = &cli.Command{
+	Name:  "schema",
+	Usage: "Print the JSON Schema of the settings file, for editor completion and validation.\nExample usage: img2theme schema >img2theme.schema.json",
+	Action: func(c *cli.Context) error {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(settingsSchema())
+	},
+}
@@ -1,27 +1,80 @@
 package main
 
 import (
-	"gopkg.in/yaml.v2"
-	"os"
+	"fmt"
+	"sort"
+	"strings"
 )
 
 type Settings struct {
-	Palette         []ColorfulColor `yaml:"palette"`
-	PaletteAffinity float64         `yaml:"palette-affinity"`
-	Cpus            int             `yaml:"cpus"`
+	Palette            Palette    `yaml:"palette" minItems:"1" desc:"Colors the image is mapped to"`
+	PaletteAffinity    float64    `yaml:"palette-affinity" minimum:"0" maximum:"1" desc:"1.0 -> colors strictly from the palette, 0.0 -> colors from the image"`
+	Metric             string     `yaml:"metric" enum:"cie76,cie94,ciede2000,oklab" desc:"Color difference the nearest palette entry is found by, empty -> cie76"`
+	Cpus               int        `yaml:"cpus" minimum:"0" desc:"Number of cpu cores to use, 0 -> all available, respecting cgroup cpu quotas"`
+	ColorCacheSize     int        `yaml:"color-cache-size" minimum:"0" desc:"Maximum number of remembered colors, 0 -> 1048576"`
+	ColorCacheEviction string     `yaml:"color-cache-eviction" enum:"lru,random" desc:"Which remembered color to forget when the color cache is full"`
+	ColorCacheKeyBits  int        `yaml:"color-cache-key-bits" minimum:"0" maximum:"8" desc:"Bits per channel used as color cache key, lower values trade accuracy for hit rate, 0 -> 8"`
+	TileSize           int        `yaml:"tile-size" minimum:"0" desc:"Side length of the square tiles handed to each cpu core, 0 -> 256"`
+	MemoryLimit        ByteSize   `yaml:"memory-limit" desc:"Decode, map and encode in bands to stay below this size, 0 -> no limit. Only non-interlaced PNG inputs are decoded in bands, other images whose decoded pixels alone exceed it are refused"`
+	ResultCache        bool       `yaml:"result-cache" desc:"Reuse outputs stored under $XDG_CACHE_HOME/img2theme for unchanged inputs and settings"`
+	ResultCacheMaxSize ByteSize   `yaml:"result-cache-max-size" desc:"Least recently used results are pruned beyond this size, 0 -> 1GiB"`
+	Mappings           []Mapping  `yaml:"mappings" desc:"Several outputs mapped from the same input, each written to its own file"`
+	Extends            stringList `yaml:"extends" desc:"Settings files this one builds on, relative to it and applied before it"`
 }
 
-func loadSettingsFromYaml(filePath string) (Settings, error) {
-	rawSettings, err := os.ReadFile(filePath)
-	if err != nil {
-		return Settings{}, err
+// Mapping is one output of a batch run, unset fields fall back to the top
+// level settings.
+type Mapping struct {
+	Name            string   `yaml:"name" desc:"Name of the mapping, available as {{name}} in the output file name"`
+	Palette         Palette  `yaml:"palette" desc:"Colors the image is mapped to"`
+	PaletteAffinity *float64 `yaml:"palette-affinity" minimum:"0" maximum:"1" desc:"1.0 -> colors strictly from the palette, 0.0 -> colors from the image"`
+	OutputFileName  string   `yaml:"output-file-name" desc:"Go text/template of the file to write, e.g. output-{{paletteAffinity}}.jpg, required with several mappings"`
+}
+
+// SettingsProblem is a mistake in the settings, Line and Column are 0 when it
+// is not from a file.
+type SettingsProblem struct {
+	Source  string
+	Path    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p SettingsProblem) String() string {
+	message := p.Message
+	if p.Path != "" {
+		message = p.Path + ": " + message
+	}
+	if p.Line != 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", p.Source, p.Line, p.Column, message)
 	}
+	if p.Source != "" {
+		return p.Source + ": " + message
+	}
+	return message
+}
 
-	settings := Settings{}
-	err = yaml.Unmarshal(rawSettings, &settings)
-	if err != nil {
-		return Settings{}, err
+// SettingsError collects every problem found in the settings.
+type SettingsError struct {
+	Problems []SettingsProblem
+}
+
+func (e *SettingsError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = problem.String()
 	}
+	return strings.Join(lines, "\n")
+}
 
-	return settings, nil
+// sortSettingsProblems orders the problems of a single source by position.
+func sortSettingsProblems(problems []SettingsProblem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
 }
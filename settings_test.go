@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func fileLayer(source, raw string) settingsLayer {
+	return settingsLayer{Source: source, Raw: []byte(raw), Positions: newYamlPositions([]byte(raw)), FromFile: true}
+}
+
+// settingsProblems merges the layers and returns their problems as
+// "source:line:column: path: message" strings.
+func settingsProblems(t *testing.T, layers ...settingsLayer) []string {
+	t.Helper()
+	_, err := mergeSettingsLayers(layers)
+	var settingsError *SettingsError
+	if !errors.As(err, &settingsError) {
+		t.Fatalf("got %v, want a SettingsError", err)
+	}
+
+	problems := make([]string, len(settingsError.Problems))
+	for i, problem := range settingsError.Problems {
+		problems[i] = problem.String()
+	}
+	return problems
+}
+
+func expectProblems(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+func TestSettingsProblemsAreLocated(t *testing.T) {
+	got := settingsProblems(t, fileLayer("s.yaml", `palette: ["#000000", "#zz0000", {color: "#ff0000", weight: -1}]
+palette-affinity: abc
+unknown-key: 1
+metric: foo
+memory-limit: 12 parsecs
+`))
+	expectProblems(t, got,
+		`s.yaml:1:22: palette[1]: invalid color "#zz0000": invalid hex digits`,
+		`s.yaml:1:60: palette[2].weight: must be above 0, got -1`,
+		`s.yaml:2:19: palette-affinity: expected a number, got "abc"`,
+		`s.yaml:3:1: unknown-key: unknown setting`,
+		`s.yaml:5:15: memory-limit: invalid byte size "12 parsecs"`,
+		`s.yaml:4:1: metric: must be one of cie76, cie94, ciede2000, oklab, got "foo"`,
+	)
+}
+
+func TestSettingsProblemsOfPaletteEntries(t *testing.T) {
+	got := settingsProblems(t, fileLayer("s.yaml", `palette:
+  - {name: red, color: "#ff0000", affinity: 2}
+  - {name: red, color: "#cc0000"}
+  - {name: blue, weight: heavy, shade: dark}
+  - {name: [x], color: "#000000"}
+`))
+	expectProblems(t, got,
+		`s.yaml:2:45: palette[0].affinity: must be between 0 and 1, got 2`,
+		`s.yaml:3:12: palette[1].name: "red" is already the name of [0]`,
+		`s.yaml:4:5: palette[2]: missing color`,
+		`s.yaml:4:26: palette[2].weight: expected a number, got "heavy"`,
+		`s.yaml:4:33: palette[2].shade: unknown key, expected name, color, weight or affinity`,
+		`s.yaml:5:12: palette[3].name: expected a string, got a list`,
+	)
+}
+
+func TestSettingsProblemsOfEqualValues(t *testing.T) {
+	got := settingsProblems(t, fileLayer("s.yaml", `mappings:
+  - palette: ["#zz0000", "#00ff00"]
+    output-file-name: a.jpg
+  - palette: ["#zz0000", "#0000ff"]
+    output-file-name: b.jpg
+`))
+	expectProblems(t, got,
+		`s.yaml:2:15: mappings[0].palette[0]: invalid color "#zz0000": invalid hex digits`,
+		`s.yaml:4:15: mappings[1].palette[0]: invalid color "#zz0000": invalid hex digits`,
+	)
+}
+
+func TestSettingsProblemsThroughAliases(t *testing.T) {
+	got := settingsProblems(t, fileLayer("s.yaml", `colors: &colors ["#000000", "#qq"]
+base: &base
+  tile-size: big
+  cpus: many
+palette: *colors
+<<: *base
+cpus: 1
+cpus: 2
+`))
+	expectProblems(t, got,
+		`s.yaml:1:29: palette[1]: invalid color "#qq": expected 3, 4, 6 or 8 hex digits`,
+		`s.yaml:3:14: tile-size: expected an integer, got "big"`,
+		`s.yaml:8:1: cpus: is already set on line 7`,
+	)
+}
+
+func TestSettingsProblemsOfOverrides(t *testing.T) {
+	override, err := settingsOverrideLayer("--set palette", "palette", `["#zz", "#fff"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := settingsProblems(t, fileLayer("s.yaml", "palette: [\"#000000\"]\nmerged: &merged 1\n"), override)
+	expectProblems(t, got, `--set palette: palette[0]: invalid color "#zz": expected 3, 4, 6 or 8 hex digits`)
+}
+
+func TestSettingsPalettesResolveOnceMerged(t *testing.T) {
+	override, err := settingsOverrideLayer("--set palette", "palette", `["#000000", "#ffffff"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a controlling terminal, as in CI, querying it would fail.
+	if _, err := mergeSettingsLayers([]settingsLayer{fileLayer("s.yaml", "palette: terminal\n"), override}); err != nil {
+		t.Errorf("got %v, want the overridden palette left unresolved", err)
+	}
+
+	got := settingsProblems(t, fileLayer("s.yaml", "palette: {union: [nord, no-such-palette]}\n"))
+	if len(got) != 1 || !strings.HasPrefix(got[0], `s.yaml:1:1: palette: unknown palette "no-such-palette"`) {
+		t.Errorf("got problems %q, want the unknown palette reported once", got)
+	}
+}
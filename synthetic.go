@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+var syntheticWorkloads = []string{"gradient", "noise", "photo"}
+
+// generateSyntheticImage draws a deterministic test image: a smooth gradient,
+// uniform per-pixel noise, or a photo-like mix of soft blobs and grain.
+func generateSyntheticImage(workload string, size image.Point, seed int64) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	random := rand.New(rand.NewSource(seed))
+
+	switch workload {
+	case "gradient":
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				img.SetRGBA(x, y, color.RGBA{
+					R: uint8(255 * x / size.X),
+					G: uint8(255 * y / size.Y),
+					B: uint8(255 * (x + y) / (size.X + size.Y)),
+					A: 255,
+				})
+			}
+		}
+	case "noise":
+		random.Read(img.Pix)
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 255
+		}
+	case "photo":
+		octaves := []*valueNoise{
+			newValueNoise(random, 4),
+			newValueNoise(random, 16),
+			newValueNoise(random, 64),
+		}
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				u, v := float64(x)/float64(size.X), float64(y)/float64(size.Y)
+				var channels [3]float64
+				for i, octave := range octaves {
+					weight := 1 / float64(int(1)<<i)
+					sample := octave.At(u, v)
+					for channel := range channels {
+						channels[channel] += sample[channel] * weight
+					}
+				}
+				var pixel [3]uint8
+				for channel, value := range channels {
+					grain := random.NormFloat64() * 4
+					pixel[channel] = uint8(math.Max(0, math.Min(255, value/1.75*255+grain)))
+				}
+				img.SetRGBA(x, y, color.RGBA{R: pixel[0], G: pixel[1], B: pixel[2], A: 255})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown workload %q, expected gradient, noise or photo", workload)
+	}
+
+	return img, nil
+}
+
+// valueNoise bilinearly interpolates random colors placed on a square grid.
+type valueNoise struct {
+	cells  int
+	colors [][3]float64
+}
+
+func newValueNoise(random *rand.Rand, cells int) *valueNoise {
+	noise := &valueNoise{cells: cells, colors: make([][3]float64, (cells+1)*(cells+1))}
+	for i := range noise.colors {
+		noise.colors[i] = [3]float64{random.Float64(), random.Float64(), random.Float64()}
+	}
+	return noise
+}
+
+func (n *valueNoise) At(u, v float64) [3]float64 {
+	x, y := u*float64(n.cells), v*float64(n.cells)
+	x0, y0 := int(x), int(y)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	corner := func(cx, cy int) [3]float64 {
+		return n.colors[cy*(n.cells+1)+cx]
+	}
+
+	var result [3]float64
+	for channel := range result {
+		top := corner(x0, y0)[channel]*(1-fx) + corner(x0+1, y0)[channel]*fx
+		bottom := corner(x0, y0+1)[channel]*(1-fx) + corner(x0+1, y0+1)[channel]*fx
+		result[channel] = top*(1-fy) + bottom*fy
+	}
+	return result
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// terminalPaletteName is the palette name that stands for the colors of
+	// the controlling terminal.
+	terminalPaletteName  = "terminal"
+	terminalQueryTimeout = time.Second
+)
+
+var (
+	// oscColorReplyPattern matches OSC 4, 10 and 11 replies, terminated by BEL
+	// or ST.
+	oscColorReplyPattern = regexp.MustCompile(`\x1b\](4;(\d+)|10|11);([^\x07\x1b]*)(?:\x07|\x1b\\)`)
+	// deviceAttributesReplyPattern matches the reply to the primary device
+	// attributes query sent last. Terminals answer it even when they ignore
+	// OSC queries, so it marks the end of the replies.
+	deviceAttributesReplyPattern = regexp.MustCompile(`\x1b\[\?[\d;]*c`)
+)
+
+// terminalColorQueries asks for the 16 ANSI colors, foreground and background,
+// then for the device attributes.
+func terminalColorQueries() []byte {
+	var queries bytes.Buffer
+	for i := 0; i < 16; i++ {
+		fmt.Fprintf(&queries, "\x1b]4;%d;?\x07", i)
+	}
+	queries.WriteString("\x1b]10;?\x07\x1b]11;?\x07\x1b[c")
+	return queries.Bytes()
+}
+
+// parseTerminalColorReplies reads the colors out of the replies received so
+// far and tells whether the last reply has arrived.
+func parseTerminalColorReplies(replies []byte) (terminalTheme, bool, error) {
+	var theme terminalTheme
+	for _, match := range oscColorReplyPattern.FindAllSubmatch(replies, -1) {
+		slot := themeForeground
+		switch {
+		case match[2] != nil:
+			slot, _ = strconv.Atoi(string(match[2]))
+			if slot > 15 {
+				continue
+			}
+		case string(match[1]) == "11":
+			slot = themeBackground
+		}
+
+		if err := theme.set(slot, string(match[3])); err != nil {
+			return theme, false, err
+		}
+	}
+
+	return theme, deviceAttributesReplyPattern.Match(replies), nil
+}
+
+// queryTerminalTheme queries terminal and reads replies until all arrive or
+// timeout passes. Reads must return every now and then.
+func queryTerminalTheme(terminal io.ReadWriter, timeout time.Duration) (terminalTheme, error) {
+	if _, err := terminal.Write(terminalColorQueries()); err != nil {
+		return terminalTheme{}, err
+	}
+
+	var replies []byte
+	buffer := make([]byte, 1024)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		n, err := terminal.Read(buffer)
+		replies = append(replies, buffer[:n]...)
+
+		theme, done, parseErr := parseTerminalColorReplies(replies)
+		if parseErr != nil {
+			return terminalTheme{}, parseErr
+		}
+		if done {
+			return theme, nil
+		}
+		if err != nil && err != io.EOF {
+			return terminalTheme{}, err
+		}
+	}
+
+	return terminalTheme{}, fmt.Errorf("the terminal did not answer color queries within %v", timeout)
+}
+
+// loadTerminalPalette queries the colors of the controlling terminal, which
+// works even when stdin and stdout are redirected to images.
+func loadTerminalPalette() (Palette, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the controlling terminal: %w", err)
+	}
+	defer tty.Close()
+
+	restore, err := makeRaw(tty)
+	if err != nil {
+		return nil, err
+	}
+	theme, err := queryTerminalTheme(tty, terminalQueryTimeout)
+	if restoreErr := restore(); err == nil {
+		err = restoreErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return theme.palette()
+}
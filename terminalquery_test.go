@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTerminal stands in for a tty in raw mode: it records the queries and
+// hands out the replies one read at a time, then reads return nothing after a
+// short wait, like a tty with VMIN 0 and VTIME set.
+type fakeTerminal struct {
+	written bytes.Buffer
+	replies []string
+}
+
+func (ft *fakeTerminal) Write(p []byte) (int, error) {
+	return ft.written.Write(p)
+}
+
+func (ft *fakeTerminal) Read(p []byte) (int, error) {
+	if len(ft.replies) == 0 {
+		time.Sleep(time.Millisecond)
+		return 0, nil
+	}
+	n := copy(p, ft.replies[0])
+	ft.replies[0] = ft.replies[0][n:]
+	if ft.replies[0] == "" {
+		ft.replies = ft.replies[1:]
+	}
+	return n, nil
+}
+
+const deviceAttributesReply = "\x1b[?62;22c"
+
+func queryFake(t *testing.T, replies ...string) terminalTheme {
+	t.Helper()
+	terminal := &fakeTerminal{replies: replies}
+	theme, err := queryTerminalTheme(terminal, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(terminal.written.Bytes(), terminalColorQueries()) {
+		t.Errorf("wrote %q, want the color queries", terminal.written.String())
+	}
+	return theme
+}
+
+func expectSlot(t *testing.T, theme terminalTheme, slot int, hex string) {
+	t.Helper()
+	if theme[slot] == nil {
+		t.Errorf("%s: missing, want %s", terminalColorNames[slot], hex)
+		return
+	}
+	if got := theme[slot].Hex(); got != hex {
+		t.Errorf("%s: got %s, want %s", terminalColorNames[slot], got, hex)
+	}
+}
+
+func TestQueryTerminalThemeChannelWidths(t *testing.T) {
+	theme := queryFake(t,
+		"\x1b]4;1;rgb:f/0/8\x07",
+		"\x1b]4;2;rgb:ff/00/80\x07",
+		"\x1b]4;3;rgb:ffff/0000/8080\x07",
+		"\x1b]4;4;rgb:fff/000/888\x07",
+		deviceAttributesReply,
+	)
+	expectSlot(t, theme, 1, "#ff0088")
+	expectSlot(t, theme, 2, "#ff0080")
+	expectSlot(t, theme, 3, "#ff0080")
+	expectSlot(t, theme, 4, "#ff0088")
+}
+
+func TestQueryTerminalThemeTerminators(t *testing.T) {
+	theme := queryFake(t,
+		"\x1b]10;rgb:d8d8/dede/e9e9\x07",
+		"\x1b]11;rgb:2e2e/3434/4040\x1b\\",
+		deviceAttributesReply,
+	)
+	expectSlot(t, theme, themeForeground, "#d8dee9")
+	expectSlot(t, theme, themeBackground, "#2e3440")
+}
+
+func TestQueryTerminalThemeSplitReplies(t *testing.T) {
+	reply := "\x1b]4;0;rgb:3b3b/4242/5252\x1b\\\x1b]11;rgb:2e2e/3434/4040\x07" + deviceAttributesReply
+	var chunks []string
+	for len(reply) > 0 {
+		n := 5
+		if n > len(reply) {
+			n = len(reply)
+		}
+		chunks = append(chunks, reply[:n])
+		reply = reply[n:]
+	}
+
+	theme := queryFake(t, chunks...)
+	expectSlot(t, theme, 0, "#3b4252")
+	expectSlot(t, theme, themeBackground, "#2e3440")
+}
+
+func TestQueryTerminalThemeMissingColor(t *testing.T) {
+	theme := queryFake(t,
+		"\x1b]4;0;rgb:0000/0000/0000\x07",
+		"\x1b]11;rgb:ffff/ffff/ffff\x07",
+		deviceAttributesReply,
+	)
+	expectSlot(t, theme, 0, "#000000")
+	expectSlot(t, theme, themeBackground, "#ffffff")
+	if theme[1] != nil || theme[themeForeground] != nil {
+		t.Errorf("unanswered queries got colors: %v, %v", theme[1], theme[themeForeground])
+	}
+}
+
+func TestQueryTerminalThemeTimeout(t *testing.T) {
+	terminal := &fakeTerminal{replies: []string{"\x1b]4;0;rgb:0000/0000/0000\x07"}}
+	start := time.Now()
+	_, err := queryTerminalTheme(terminal, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Fatalf("got %v, want a timeout error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gave up after %v, want about 50ms", elapsed)
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlParser reads the TOML subset of terminal themes, keeping numbers,
+// booleans and dates as raw text.
+type tomlParser struct {
+	source string
+	offset int
+	line   int
+}
+
+// parseToml flattens a TOML document to its values by dotted key.
+func parseToml(source string) (map[string]interface{}, error) {
+	p := &tomlParser{source: source, line: 1}
+	values := map[string]interface{}{}
+	table := ""
+
+	for {
+		p.skipBlankLines()
+		if p.done() {
+			return values, nil
+		}
+
+		if p.peek() == '[' {
+			p.offset++
+			arrayOfTables := p.peek() == '['
+			if arrayOfTables {
+				p.offset++
+			}
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if arrayOfTables {
+				if err := p.expect("]"); err != nil {
+					return nil, err
+				}
+			}
+			table = key
+		} else {
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if table != "" {
+				key = table + "." + key
+			}
+			flattenThemeValues(key+".", value, values)
+		}
+
+		p.skipSpaces()
+		if !p.done() && p.peek() != '\n' {
+			return nil, p.errorf("expected a new line")
+		}
+	}
+}
+
+func (p *tomlParser) done() bool {
+	return p.offset >= len(p.source)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.source[p.offset]
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpaces skips spaces, tabs, carriage returns and a trailing comment.
+func (p *tomlParser) skipSpaces() {
+	for !p.done() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.offset++
+		case '#':
+			for !p.done() && p.peek() != '\n' {
+				p.offset++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipBlankLines() {
+	for {
+		p.skipSpaces()
+		if p.done() || p.peek() != '\n' {
+			return
+		}
+		p.offset++
+		p.line++
+	}
+}
+
+func (p *tomlParser) expect(token string) error {
+	p.skipSpaces()
+	if !strings.HasPrefix(p.source[p.offset:], token) {
+		return p.errorf("expected %q", token)
+	}
+	p.offset += len(token)
+	return nil
+}
+
+// key reads a possibly dotted key, bare or quoted.
+func (p *tomlParser) key() (string, error) {
+	var parts []string
+	for {
+		p.skipSpaces()
+		if p.done() {
+			return "", p.errorf("expected a key")
+		}
+
+		if c := p.peek(); c == '"' || c == '\'' {
+			part, err := p.string()
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		} else {
+			start := p.offset
+			for !p.done() && isTomlBareKeyByte(p.peek()) {
+				p.offset++
+			}
+			if start == p.offset {
+				return "", p.errorf("expected a key")
+			}
+			parts = append(parts, p.source[start:p.offset])
+		}
+
+		p.skipSpaces()
+		if p.done() || p.peek() != '.' {
+			return strings.Join(parts, "."), nil
+		}
+		p.offset++
+	}
+}
+
+func isTomlBareKeyByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	p.skipSpaces()
+	if p.done() {
+		return nil, p.errorf("expected a value")
+	}
+
+	switch p.peek() {
+	case '"', '\'':
+		return p.string()
+	case '[':
+		p.offset++
+		var array []interface{}
+		for {
+			p.skipBlankLines()
+			if p.done() {
+				return nil, p.errorf("unterminated array")
+			}
+			if p.peek() == ']' {
+				p.offset++
+				return array, nil
+			}
+
+			element, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, element)
+
+			p.skipBlankLines()
+			if !p.done() && p.peek() == ',' {
+				p.offset++
+			}
+		}
+	case '{':
+		p.offset++
+		table := map[string]interface{}{}
+		for {
+			p.skipSpaces()
+			if p.done() {
+				return nil, p.errorf("unterminated inline table")
+			}
+			if p.peek() == '}' {
+				p.offset++
+				return table, nil
+			}
+
+			key, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			table[key] = value
+
+			p.skipSpaces()
+			if !p.done() && p.peek() == ',' {
+				p.offset++
+			}
+		}
+	}
+
+	start := p.offset
+	for !p.done() && !strings.ContainsRune(",]}#\n", rune(p.peek())) {
+		p.offset++
+	}
+	raw := strings.TrimSpace(p.source[start:p.offset])
+	if raw == "" {
+		return nil, p.errorf("expected a value")
+	}
+	return raw, nil
+}
+
+// string reads a basic "string" with escapes or a literal 'string'. Multi-line
+// strings are not supported.
+func (p *tomlParser) string() (string, error) {
+	quote := p.peek()
+	end := p.offset + 1
+	for end < len(p.source) && p.source[end] != quote && p.source[end] != '\n' {
+		if quote == '"' && p.source[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(p.source) || p.source[end] != quote {
+		return "", p.errorf("unterminated string")
+	}
+
+	raw := p.source[p.offset : end+1]
+	p.offset = end + 1
+	if quote == '\'' {
+		return raw[1 : len(raw)-1], nil
+	}
+
+	value, err := strconv.Unquote(raw)
+	if err != nil {
+		return "", p.errorf("invalid string %s", raw)
+	}
+	return value, nil
+}
+
+// parsePlist decodes an XML property list into maps, slices, strings,
+// float64s and bools.
+func parsePlist(raw []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("expected an XML property list: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return plistValue(decoder, start)
+		}
+	}
+}
+
+func plistValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]interface{}{}
+		key := ""
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch token := token.(type) {
+			case xml.EndElement:
+				return dict, nil
+			case xml.StartElement:
+				if token.Name.Local == "key" {
+					if err := decoder.DecodeElement(&key, &token); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := plistValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			}
+		}
+	case "array":
+		var array []interface{}
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch token := token.(type) {
+			case xml.EndElement:
+				return array, nil
+			case xml.StartElement:
+				value, err := plistValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+		}
+	case "true", "false":
+		return start.Name.Local == "true", decoder.Skip()
+	}
+
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "real", "integer":
+		number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid <%s> %q", start.Name.Local, text)
+		}
+		return number, nil
+	}
+	return text, nil
+}
+
+// stripJsonComments blanks out the comments and trailing commas of JSONC,
+// keeping offsets.
+func stripJsonComments(raw []byte) []byte {
+	stripped := append([]byte{}, raw...)
+	comma := -1
+	for i := 0; i < len(stripped); i++ {
+		switch c := stripped[i]; {
+		case c == '"':
+			for i++; i < len(stripped) && stripped[i] != '"'; i++ {
+				if stripped[i] == '\\' {
+					i++
+				}
+			}
+			comma = -1
+		case c == '/' && i+1 < len(stripped) && (stripped[i+1] == '/' || stripped[i+1] == '*'):
+			end := len(stripped)
+			if stripped[i+1] == '/' {
+				if n := bytes.IndexByte(stripped[i:], '\n'); n >= 0 {
+					end = i + n
+				}
+			} else if n := bytes.Index(stripped[i+2:], []byte("*/")); n >= 0 {
+				end = i + 2 + n + 2
+			} else {
+				// Leave an unterminated comment for the JSON decoder to report.
+				return stripped
+			}
+			for j := i; j < end; j++ {
+				if stripped[j] != '\n' {
+					stripped[j] = ' '
+				}
+			}
+			i = end - 1
+		case c == ',':
+			comma = i
+		case c == '}' || c == ']':
+			if comma >= 0 {
+				stripped[comma] = ' '
+			}
+			comma = -1
+		case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+			comma = -1
+		}
+	}
+	return stripped
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func makeRaw(tty *os.File) (func() error, error) {
+	return nil, fmt.Errorf("querying the terminal palette is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func ioctlTermios(tty *os.File, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw turns off echo and line buffering on tty, with reads timing out
+// after a tenth of a second.
+func makeRaw(tty *os.File) (func() error, error) {
+	var previous syscall.Termios
+	if err := ioctlTermios(tty, ioctlGetTermios, &previous); err != nil {
+		return nil, err
+	}
+
+	raw := previous
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 1
+	if err := ioctlTermios(tty, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+
+	return func() error { return ioctlTermios(tty, ioctlSetTermios, &previous) }, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+var validateCommand = &cli.Command{
+	Name:      "validate",
+	Usage:     "Check the settings and list every problem in them.\nExample usage: img2theme validate settings.yaml",
+	ArgsUsage: "[settings.yaml...]",
+	Flags:     settingsFlags(),
+	Action:    validateAction,
+}
+
+func validateAction(c *cli.Context) error {
+	_, err := loadSettings(c)
+
+	var settingsError *SettingsError
+	if errors.As(err, &settingsError) {
+		fmt.Fprintln(os.Stderr, settingsError)
+		return cli.Exit(fmt.Sprintf("found %d problem(s)", len(settingsError.Problems)), 1)
+	}
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	fmt.Println("settings are valid")
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"image"
+	"sync"
+)
+
+// workerPool runs submitted tasks on a fixed number of goroutines. Tasks must
+// not submit further tasks to the pool they are running on.
+type workerPool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+}
+
+func newWorkerPool(workers int) *workerPool {
+	pool := &workerPool{
+		tasks: make(chan func(), workers),
+	}
+
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for task := range pool.tasks {
+				task()
+			}
+		}()
+	}
+
+	return pool
+}
+
+func (p *workerPool) Submit(task func()) {
+	p.tasks <- task
+}
+
+func (p *workerPool) Close() {
+	close(p.tasks)
+	p.wg.Wait()
+}
+
+// RunTiles splits rect into square tiles, runs fn for each of them on the pool
+// and waits until all of them are done.
+func (p *workerPool) RunTiles(rect image.Rectangle, tileSize int, fn func(tile image.Rectangle)) {
+	var wg sync.WaitGroup
+
+	for y := rect.Min.Y; y < rect.Max.Y; y += tileSize {
+		for x := rect.Min.X; x < rect.Max.X; x += tileSize {
+			tile := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(rect)
+
+			wg.Add(1)
+			p.Submit(func() {
+				defer wg.Done()
+				fn(tile)
+			})
+		}
+	}
+
+	wg.Wait()
+}
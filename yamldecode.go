@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlNodeError is a value that could not be decoded, Path leading to it from
+// the decoded value, like "[2].weight".
+type yamlNodeError struct {
+	Node    *yaml.Node
+	Path    string
+	Message string
+}
+
+// yamlNodeErrors are all the values of a document that could not be decoded,
+// so that they can be fixed in one go.
+type yamlNodeErrors []*yamlNodeError
+
+func yamlNodeErrorf(node *yaml.Node, format string, args ...interface{}) yamlNodeErrors {
+	return yamlNodeErrors{{Node: node, Message: fmt.Sprintf(format, args...)}}
+}
+
+func (errs yamlNodeErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		message := err.Message
+		if err.Path != "" {
+			message = err.Path + ": " + message
+		}
+		messages[i] = fmt.Sprintf("line %d: %s", err.Node.Line, message)
+	}
+	return strings.Join(messages, "\n")
+}
+
+// under moves the errors of a value to where it is found at path.
+func (errs yamlNodeErrors) under(path string) yamlNodeErrors {
+	for _, err := range errs {
+		err.Path = joinYamlPath(path, err.Path)
+	}
+	return errs
+}
+
+func joinYamlPath(path, rest string) string {
+	if path == "" || rest == "" || strings.HasPrefix(rest, "[") {
+		return path + rest
+	}
+	return path + "." + rest
+}
+
+// asYamlNodeErrors keeps the errors an unmarshaler returned for values within
+// node, other errors are blamed on node itself.
+func asYamlNodeErrors(node *yaml.Node, err error) yamlNodeErrors {
+	var errs yamlNodeErrors
+	if errors.As(err, &errs) {
+		return errs
+	}
+	return yamlNodeErrorf(node, "%v", err)
+}
+
+// parseYamlDocument returns the top node of a document, nil when it is empty.
+func parseYamlDocument(raw []byte) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	return document.Content[0], nil
+}
+
+// resolveYamlAlias returns the node an alias refers to.
+func resolveYamlAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// yamlMappingPairs returns the pairs of a mapping followed by those merged in
+// with << that it does not set itself.
+func yamlMappingPairs(node *yaml.Node) ([][2]*yaml.Node, yamlNodeErrors) {
+	var pairs, merged [][2]*yaml.Node
+	var errs yamlNodeErrors
+	setOn := map[string]int{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag == "!!merge" {
+			value = resolveYamlAlias(value)
+			sources := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				sources = value.Content
+			}
+			for _, source := range sources {
+				source = resolveYamlAlias(source)
+				if source.Kind != yaml.MappingNode {
+					errs = append(errs, yamlNodeErrorf(source, "only mappings can be merged with <<")...)
+					continue
+				}
+				sourcePairs, sourceErrs := yamlMappingPairs(source)
+				merged = append(merged, sourcePairs...)
+				errs = append(errs, sourceErrs...)
+			}
+			continue
+		}
+
+		if line, ok := setOn[key.Value]; ok {
+			errs = append(errs, &yamlNodeError{Node: key, Path: key.Value, Message: fmt.Sprintf("is already set on line %d", line)})
+			continue
+		}
+		setOn[key.Value] = key.Line
+		pairs = append(pairs, [2]*yaml.Node{key, value})
+	}
+
+	for _, pair := range merged {
+		if _, ok := setOn[pair[0].Value]; !ok {
+			setOn[pair[0].Value] = pair[0].Line
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, errs
+}
+
+// yamlMappingValue returns the value of key in a mapping, or the mapping
+// itself when the key is not set.
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	pairs, _ := yamlMappingPairs(node)
+	for _, pair := range pairs {
+		if pair[0].Value == key {
+			return resolveYamlAlias(pair[1])
+		}
+	}
+	return node
+}
+
+// decodeYamlNode decodes like yaml.v3 but goes on past bad values and rejects
+// unknown keys, returning an error at each.
+func decodeYamlNode(node *yaml.Node, out interface{}) error {
+	if errs := decodeYamlValue(node, reflect.ValueOf(out).Elem()); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func decodeYamlValue(node *yaml.Node, value reflect.Value) yamlNodeErrors {
+	node = resolveYamlAlias(node)
+	if unmarshaler, ok := value.Addr().Interface().(yaml.Unmarshaler); ok {
+		if err := unmarshaler.UnmarshalYAML(node); err != nil {
+			return asYamlNodeErrors(node, err)
+		}
+		return nil
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer:
+		target := reflect.New(value.Type().Elem())
+		errs := decodeYamlValue(node, target.Elem())
+		if errs == nil {
+			value.Set(target)
+		}
+		return errs
+	case reflect.Struct:
+		return decodeYamlStruct(node, value)
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return yamlNodeErrorf(node, "expected a list, got %s", describeYamlNode(node))
+		}
+		items := reflect.MakeSlice(value.Type(), len(node.Content), len(node.Content))
+		var errs yamlNodeErrors
+		for i, item := range node.Content {
+			errs = append(errs, decodeYamlValue(item, items.Index(i)).under("["+strconv.Itoa(i)+"]")...)
+		}
+		value.Set(items)
+		return errs
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Decode(value.Addr().Interface()) != nil {
+		return yamlNodeErrorf(node, "expected %s, got %s", describeYamlKind(value.Kind()), describeYamlNode(node))
+	}
+	return nil
+}
+
+func decodeYamlStruct(node *yaml.Node, value reflect.Value) yamlNodeErrors {
+	if node.Kind != yaml.MappingNode {
+		return yamlNodeErrorf(node, "expected a mapping, got %s", describeYamlNode(node))
+	}
+
+	fields := map[string]int{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if name := yamlFieldName(field); field.IsExported() && name != "-" {
+			fields[name] = i
+		}
+	}
+
+	pairs, errs := yamlMappingPairs(node)
+	for _, pair := range pairs {
+		key, item := pair[0], pair[1]
+		index, ok := fields[key.Value]
+		if !ok {
+			errs = append(errs, &yamlNodeError{Node: key, Path: key.Value, Message: "unknown setting"})
+			continue
+		}
+		errs = append(errs, decodeYamlValue(item, value.Field(index)).under(key.Value)...)
+	}
+	return errs
+}
+
+func describeYamlKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	}
+	return "a " + kind.String()
+}
+
+func describeYamlNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.MappingNode:
+		return "a mapping"
+	}
+	return strconv.Quote(node.Value)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlPosition is a 1-based line and column in a YAML document.
+type yamlPosition struct {
+	Line   int
+	Column int
+}
+
+type yamlPositionEntry struct {
+	yamlPosition
+	Path string
+	// Anchor is the name of the anchor the value defines, if any.
+	Anchor string
+}
+
+// yamlPositions locates keys and sequence items by path, like "palette[2]",
+// where their anchor writes them.
+type yamlPositions struct {
+	entries []yamlPositionEntry
+	byPath  map[string]int
+}
+
+// maxYamlAliasedPositions stops following aliases once this many entries are
+// recorded, so nested aliases cannot blow the positions up exponentially.
+const maxYamlAliasedPositions = 1 << 16
+
+func newYamlPositions(raw []byte) *yamlPositions {
+	positions := &yamlPositions{byPath: map[string]int{}}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(raw, &document); err != nil {
+		// Decoding the settings reports the syntax error.
+		return positions
+	}
+	if len(document.Content) > 0 {
+		positions.addNode(document.Content[0], "")
+	}
+	return positions
+}
+
+// addNode records the children of node, which is found at path.
+func (p *yamlPositions) addNode(node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		if len(p.entries) < maxYamlAliasedPositions {
+			p.addNode(node.Alias, path)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := path + "[" + strconv.Itoa(i) + "]"
+			p.add(itemPath, item, item)
+			p.addNode(item, itemPath)
+		}
+	case yaml.MappingNode:
+		var merged []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				merged = append(merged, value)
+				continue
+			}
+
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+			p.add(keyPath, key, value)
+			p.addNode(value, keyPath)
+		}
+
+		// Keys written in the mapping were added first and win over merged
+		// ones, as they do when decoding.
+		for _, value := range merged {
+			if value.Kind == yaml.SequenceNode {
+				for _, item := range value.Content {
+					p.addNode(item, path)
+				}
+				continue
+			}
+			p.addNode(value, path)
+		}
+	}
+}
+
+// add records path at the position of at, with the anchor value defines.
+func (p *yamlPositions) add(path string, at, value *yaml.Node) {
+	entry := yamlPositionEntry{
+		yamlPosition: yamlPosition{Line: at.Line, Column: at.Column},
+		Path:         path,
+		Anchor:       value.Anchor,
+	}
+
+	if _, ok := p.byPath[path]; !ok {
+		p.byPath[path] = len(p.entries)
+	}
+	p.entries = append(p.entries, entry)
+}
+
+// Lookup returns the position of path, falling back to its closest ancestor
+// that was found in the document.
+func (p *yamlPositions) Lookup(path string) (yamlPosition, bool) {
+	for path != "" {
+		if index, ok := p.byPath[path]; ok {
+			return p.entries[index].yamlPosition, true
+		}
+
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+
+	return yamlPosition{}, false
+}
+
+// Anchor returns the name of the anchor defined by the value at path.
+func (p *yamlPositions) Anchor(path string) (string, bool) {
+	index, ok := p.byPath[path]
+	if !ok {
+		return "", false
+	}
+	return p.entries[index].Anchor, true
+}